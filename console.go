@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/slytomcat/yandex-disk-simulator/simulator"
+)
+
+const (
+	// number of recent transitions shown by console
+	consoleTransitions = 5
+	// number of cli.log lines shown by console
+	consoleLogLines = 10
+	// step of progress changes in console
+	consoleProgressStep = 10
+)
+
+// console key bindings
+const consoleKeys = "s - sync, e - error, c - chaos, m - markov, p - progress +10%, n - network on/off, t - step, x - stop daemon, q - quit"
+
+// consoleView is the content of console screen
+type consoleView struct {
+	message     string   // current status message
+	transitions []string // recent status transitions
+	logLines    []string // recent cli.log lines
+	reply       string   // reply on the last command
+	progress    int      // last set progress percent
+}
+
+// update adds the update from daemon into the view
+func (v *consoleView) update(u simulator.Update) {
+	switch u.Type {
+	case "status":
+		v.message = u.Message
+		v.transitions = lastLines(append(v.transitions, u.Time.Format("15:04:05.000")+" "+u.State), consoleTransitions)
+	case "log":
+		v.logLines = lastLines(append(v.logLines, u.Message), consoleLogLines)
+	}
+}
+
+// lastLines returns up to n last lines
+func lastLines(lines []string, n int) []string {
+	return lines[max(0, len(lines)-n):]
+}
+
+// render returns the console screen content
+func (v *consoleView) render() string {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J") // move cursor home and clear screen
+	fmt.Fprintf(&b, "Keys: %s\n\n", consoleKeys)
+	fmt.Fprintf(&b, "Status:\n%s\n", strings.TrimRight(v.message, "\n"))
+	fmt.Fprintf(&b, "\nTransitions:\n%s\n", strings.Join(v.transitions, "\n"))
+	fmt.Fprintf(&b, "\ncli.log:\n%s\n", strings.Join(v.logLines, "\n"))
+	if v.reply != "" {
+		fmt.Fprintf(&b, "\n%s\n", v.reply)
+	}
+	return b.String()
+}
+
+// consoleCommand returns the daemon command with arguments bound to the key or
+// nil when the key isn't bound. The progress key moves the view progress forward.
+func (v *consoleView) consoleCommand(key byte) []string {
+	switch key {
+	case 's':
+		return []string{"sync"}
+	case 'e':
+		return []string{"error"}
+	case 'c':
+		return []string{"chaos"}
+	case 'm':
+		return []string{"markov"}
+	case 'p':
+		v.progress = (v.progress + consoleProgressStep) % (100 + consoleProgressStep)
+		return []string{"progress", strconv.Itoa(v.progress)}
+	case 'n':
+		return []string{"network"}
+	case 't':
+		return []string{"step"}
+	case 'x':
+		return []string{"stop"}
+	}
+	return nil
+}
+
+// console shows the daemon status, transitions and cli.log lines in the terminal and
+// sends the commands bound to the pressed keys until q (or Ctrl+C) is pressed or the
+// daemon stops
+func console(cat *simulator.Catalog) error {
+	if notExists(socketPath) {
+		return productErr(exitNotStarted, "Error: daemon not started")
+	}
+	restore, err := rawTerminal(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer restore()
+	conn, err := simulator.Dial(socketPath, "watch")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	updates := make(chan simulator.Update)
+	go func() {
+		defer close(updates)
+		dec := json.NewDecoder(conn)
+		for {
+			var u simulator.Update
+			if dec.Decode(&u) != nil {
+				return
+			}
+			updates <- u
+		}
+	}()
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				close(keys)
+				return
+			}
+			// the line ends are read when the terminal is in line mode
+			if buf[0] != '\n' && buf[0] != '\r' {
+				keys <- buf[0]
+			}
+		}
+	}()
+	// the commands are sent in background as the reply can be delayed (e.g. by the fault
+	// latency or hang) and the replies are shown when they are received
+	replies := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	v := &consoleView{}
+	for {
+		select {
+		case r := <-replies:
+			v.reply = r
+		case u, ok := <-updates:
+			if !ok {
+				fmt.Print(v.render(), "\n", cat.Message("Daemon stopped."), "\n")
+				return nil
+			}
+			if u.Type == "status" {
+				u.Message = cat.Text(u.Message)
+			}
+			v.update(u)
+		case key, ok := <-keys:
+			if !ok || key == 'q' || key == 3 { // 3 is Ctrl+C
+				return nil
+			}
+			cmd := v.consoleCommand(key)
+			if cmd == nil {
+				v.reply = "Unknown key: " + strconv.QuoteRune(rune(key))
+				break
+			}
+			v.reply = strings.Join(cmd, " ") + ": sent"
+			go func() {
+				r := strings.Join(cmd, " ") + ": done"
+				if _, err := simulator.Command(socketPath, cmd[0], cmd[1:]...); err != nil && !errors.Is(err, simulator.ErrStopped) {
+					r = strings.Join(cmd, " ") + ": " + err.Error()
+				}
+				select {
+				case replies <- r:
+				case <-done:
+				}
+			}()
+		}
+		fmt.Print(v.render())
+	}
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// rawTerminal switches the terminal off the line editing, echo and signals to read
+// the keys one by one. It returns the function that restores the terminal settings.
+func rawTerminal(fd int) (func(), error) {
+	var t syscall.Termios
+	if err := termios(fd, syscall.TCGETS, &t); err != nil {
+		return nil, fmt.Errorf("console requires terminal: %w", err)
+	}
+	saved := t
+	t.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := termios(fd, syscall.TCSETS, &t); err != nil {
+		return nil, fmt.Errorf("terminal setting error: %w", err)
+	}
+	return func() { termios(fd, syscall.TCSETS, &saved) }, nil
+}
+
+// termios gets or sets (depending on the request) the terminal settings
+func termios(fd int, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// check that console requires terminal
+func TestRawTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+	_, err = rawTerminal(int(r.Fd()))
+	require.ErrorContains(t, err, "console requires terminal: ")
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+// rawTerminal keeps the terminal in line mode on systems without Linux termios
+// requests: the keys are read after Enter is pressed. It returns the function that
+// does nothing as there is nothing to restore.
+func rawTerminal(fd int) (func(), error) {
+	return func() {}, nil
+}
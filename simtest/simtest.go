@@ -0,0 +1,179 @@
+// Package simtest runs the simulated yandex-disk daemon in-process for Go tests.
+//
+// Start prepares the temporary configuration and synchronized directories, starts
+// the daemon on a private socket and stops it when the test is finished:
+//
+//	d := simtest.Start(t, simulator.Options{Scale: 0.1})
+//	d.WaitState("idle", 5*time.Second)
+//	d.Sync()
+//
+// Use Env to pass the daemon location to the yandex-disk-simulator utility or to
+// the client under test.
+package simtest
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/slytomcat/yandex-disk-simulator/simulator"
+)
+
+// Daemon - the handle of in-process simulated daemon started by Start
+type Daemon struct {
+	ConfDir string // configuration directory path
+	SyncDir string // synchronized directory path
+	Socket  string // daemon socket path
+
+	t       testing.TB
+	daemon  *simulator.Daemon // in-process daemon
+	done    chan error        // receives the daemon serving result
+	stopped bool              // daemon was stopped by Stop
+}
+
+// Start sets up the temporary configuration and synchronized directories, starts
+// the daemon in-process on a private socket and stops it via t.Cleanup.
+func Start(t testing.TB, opts simulator.Options) *Daemon {
+	t.Helper()
+	dir := t.TempDir()
+	// unix socket path length is limited, so the socket is created in short temporary path
+	sockDir, err := os.MkdirTemp("", "yds")
+	if err != nil {
+		t.Fatalf("socket directory creation error: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(sockDir) })
+	d := &Daemon{
+		ConfDir: filepath.Join(dir, "config"),
+		SyncDir: filepath.Join(dir, "Yandex.Disk"),
+		Socket:  filepath.Join(sockDir, "socket"),
+		t:       t,
+		done:    make(chan error, 1),
+	}
+	if err := simulator.Setup(d.ConfDir, d.SyncDir); err != nil {
+		t.Fatal(err)
+	}
+	d.daemon = &simulator.Daemon{SyncDir: d.SyncDir, Socket: d.Socket, Options: opts}
+	if err := d.daemon.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		err := d.daemon.Serve()
+		d.daemon.Close()
+		d.done <- err
+	}()
+	t.Cleanup(func() {
+		if !d.stopped {
+			d.Stop()
+		}
+	})
+	return d
+}
+
+// Env returns the environment variables that point the yandex-disk-simulator
+// utility to the daemon configuration, synchronized directory and socket
+func (d *Daemon) Env() []string {
+	return []string{
+		"Sim_ConfDir=" + d.ConfDir,
+		"Sim_SyncDir=" + d.SyncDir,
+		"Sim_Socket=" + d.Socket,
+	}
+}
+
+// Command sends the command with its arguments to the daemon and returns the reply
+func (d *Daemon) Command(cmd string, args ...string) (string, error) {
+	return simulator.Command(d.Socket, cmd, args...)
+}
+
+// command sends the command to the daemon and fails the test on error
+func (d *Daemon) command(cmd string, args ...string) string {
+	d.t.Helper()
+	reply, err := d.Command(cmd, args...)
+	if err != nil {
+		d.t.Fatalf("%s command error: %v", cmd, err)
+	}
+	return reply
+}
+
+// Status returns the current daemon status message
+func (d *Daemon) Status() string {
+	d.t.Helper()
+	return d.command("status")
+}
+
+// Sync begins the synchronization simulation
+func (d *Daemon) Sync() {
+	d.t.Helper()
+	d.command("sync")
+}
+
+// Error begins the error simulation
+func (d *Daemon) Error() {
+	d.t.Helper()
+	d.command("error")
+}
+
+// Chaos begins the chaos simulation with the seed
+func (d *Daemon) Chaos(seed int64) {
+	d.t.Helper()
+	d.command("chaos", "--seed", strconv.FormatInt(seed, 10))
+}
+
+// Step makes the next transition in step mode and returns the new status message
+func (d *Daemon) Step() string {
+	d.t.Helper()
+	return d.command("step")
+}
+
+// WaitState waits until the daemon reaches the state (e.g. "idle" or "finished")
+// and returns the status message. The test fails when the state isn't reached
+// within the timeout.
+func (d *Daemon) WaitState(state string, timeout time.Duration) string {
+	d.t.Helper()
+	return d.command("wait", state, "--timeout", timeout.String())
+}
+
+// Stats returns the statistics of commands received by the daemon
+func (d *Daemon) Stats() map[string]simulator.CommandStats {
+	d.t.Helper()
+	var stats map[string]simulator.CommandStats
+	if err := json.Unmarshal([]byte(d.command("stats", "--json")), &stats); err != nil {
+		d.t.Fatalf("stats parsing error: %v", err)
+	}
+	return stats
+}
+
+// Fault sets the fault of daemon replies on the command, the zero fault removes it.
+// The fault of stop command is removed by Stop.
+func (d *Daemon) Fault(cmd string, f simulator.Fault) {
+	d.t.Helper()
+	if err := d.daemon.SetFault(cmd, f); err != nil {
+		d.t.Fatalf("fault setting error: %v", err)
+	}
+}
+
+// CliLog returns the content of daemon's synchronization log (cli.log)
+func (d *Daemon) CliLog() string {
+	d.t.Helper()
+	data, err := os.ReadFile(simulator.CliLogPath(d.SyncDir))
+	if err != nil {
+		d.t.Fatalf("cli.log reading error: %v", err)
+	}
+	return string(data)
+}
+
+// Stop stops the daemon and waits for its finish
+func (d *Daemon) Stop() {
+	d.t.Helper()
+	d.stopped = true
+	d.daemon.SetFault("stop", simulator.Fault{})
+	if _, err := d.Command("stop"); !errors.Is(err, simulator.ErrStopped) {
+		d.t.Fatalf("stop command error: %v", err)
+	}
+	if err := <-d.done; err != nil {
+		d.t.Fatalf("daemon error: %v", err)
+	}
+}
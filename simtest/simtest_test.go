@@ -0,0 +1,94 @@
+package simtest
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slytomcat/yandex-disk-simulator/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+// try to drive the accelerated daemon through start, synchronization and error
+func TestStart(t *testing.T) {
+	d := Start(t, simulator.Options{Scale: 0.01})
+	require.Contains(t, d.WaitState("idle", 2*time.Second), "Synchronization core status: idle\n")
+	d.Sync()
+	require.Contains(t, d.WaitState("finished", 2*time.Second), "Synchronization core status: idle\n")
+	require.Contains(t, d.CliLog(), " INFO  Uploaded file: 'NewFile'\n")
+	d.Error()
+	require.Contains(t, d.WaitState("finished", 2*time.Second), "Synchronization core status: idle\n")
+	require.Contains(t, d.CliLog(), " ERROR access error: 'downloads/test1'\n")
+	_, err := d.Command("network")
+	require.NoError(t, err)
+	require.Contains(t, d.WaitState("no internet access", 2*time.Second), "Synchronization core status: no internet access\n")
+	d.Stop()
+	require.NoFileExists(t, d.Socket)
+}
+
+// try to run two daemons in step mode in the same test and leave them to cleanup
+func TestStartStepping(t *testing.T) {
+	for range 2 {
+		d := Start(t, simulator.Options{Stepping: true})
+		require.Equal(t, "", d.Status())
+		d.Step()
+		require.Contains(t, d.Step(), "Synchronization core status: paused\n")
+		require.Contains(t, d.Status(), "Synchronization core status: paused\n")
+		require.Contains(t, d.Env(), "Sim_Socket="+d.Socket)
+	}
+}
+
+// try to reproduce the chaos simulation by its seed
+func TestChaos(t *testing.T) {
+	var logs []string
+	for range 2 {
+		d := Start(t, simulator.Options{Scale: 0.001})
+		d.WaitState("finished", 2*time.Second)
+		start := len(d.CliLog())
+		d.Chaos(5)
+		d.WaitState("finished", 5*time.Second)
+		// the entries are compared without their times
+		var chaos []string
+		for _, entry := range strings.Split(strings.TrimSuffix(d.CliLog()[start:], "\n"), "\n") {
+			_, entry, _ = strings.Cut(entry, " ")
+			_, entry, _ = strings.Cut(entry, " ")
+			chaos = append(chaos, entry)
+		}
+		require.Greater(t, len(chaos), 1)
+		logs = append(logs, strings.Join(chaos, "\n"))
+	}
+	require.Equal(t, logs[0], logs[1])
+}
+
+// try to check the status polling rate
+func TestStats(t *testing.T) {
+	d := Start(t, simulator.Options{Scale: 0.01})
+	for range 3 {
+		d.Status()
+	}
+	stats := d.Stats()
+	require.Equal(t, 3, stats["status"].Count)
+	require.LessOrEqual(t, stats["status"].MaxPerSecond, 3)
+}
+
+// try to get the partial reply and the latency of the daemon
+func TestFault(t *testing.T) {
+	d := Start(t, simulator.Options{Scale: 0.01})
+	d.WaitState("idle", time.Second)
+	d.Fault("status", simulator.Fault{Partial: 4})
+	require.Equal(t, "Sync", d.Status())
+	d.Fault("status", simulator.Fault{})
+	require.Contains(t, d.Status(), "Synchronization core status: ")
+	d.Fault("stop", simulator.Fault{Latency: time.Hour})
+}
+
+// try to get error reply from the daemon
+func TestCommandError(t *testing.T) {
+	d := Start(t, simulator.Options{Scale: 0.01})
+	_, err := d.Command("wait", "error", "--timeout", "1ms")
+	require.EqualError(t, err, "Error: 'error' state hasn't been reached within 1ms")
+	require.NoError(t, os.RemoveAll(d.SyncDir))
+	_, err = d.Command("status")
+	require.EqualError(t, err, "Error: Indicated directory does not exist")
+}
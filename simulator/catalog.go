@@ -0,0 +1,153 @@
+package simulator
+
+import (
+	"strings"
+)
+
+// Catalog - the message catalog of output language. It translates the status messages,
+// start/stop messages and the texts of original product errors. The nil Catalog keeps
+// the English messages and texts.
+type Catalog struct {
+	Lang     string            // language code, e.g. "ru"
+	Texts    map[string]string // translations of whole lines and line prefixes (ending by ':') of messages and errors
+	Messages map[string]string // translations of start/stop messages
+}
+
+// Catalogs - the known message catalogs by language codes
+var Catalogs = map[string]*Catalog{
+	"ru": {
+		Lang: "ru",
+		Texts: map[string]string{
+			// status messages: the known line prefixes are translated, the rest of line is kept
+			"Synchronization core status: ":          "Статус ядра синхронизации: ",
+			"Path to Yandex.Disk directory: ":        "Путь к папке Яндекс.Диска: ",
+			"Total: ":                                "Всего: ",
+			"Used: ":                                 "Использовано: ",
+			"Available: ":                            "Свободно: ",
+			"Max file size: ":                        "Максимальный размер файла: ",
+			"Trash size: ":                           "Размер корзины: ",
+			"Last synchronized items:":               "Последние синхронизированные элементы:",
+			"Last synchronized files:":               "Последние синхронизированные файлы:",
+			"file: ":                                 "файл: ",
+			"Sync progress: ":                        "Прогресс синхронизации: ",
+			"The quota has not been received yet.":   "Информация о квоте еще не получена.",
+			"Quota information is not received yet.": "Информация о квоте еще не получена.",
+			"Path: ":                                 "Путь: ",
+			"access error":                           "ошибка доступа",
+			"Error: ":                                "Ошибка: ",
+			// errors
+			"Error: command hasn't been specified. Use the --help command to access help\nor setup to launch the setup wizard.": "Ошибка: команда не указана. Используйте команду --help для получения справки\nили setup для запуска мастера настройки.",
+			"Error: daemon not started":                 "Ошибка: демон не запущен",
+			"Error: daemon is not running":              "Ошибка: демон не запущен",
+			"Error: unknown command:":                   "Ошибка: неизвестная команда:",
+			"Error: unknown option:":                    "Ошибка: неизвестный параметр:",
+			"Error: option 'dir' is missing":            "Ошибка: отсутствует параметр 'dir'",
+			"Error: Indicated directory does not exist": "Ошибка: указанная папка не существует",
+			"Error: indicated directory does not exist": "Ошибка: указанная папка не существует",
+		},
+		Messages: map[string]string{
+			"Starting daemon process...": "Запуск демона...",
+			"Done":                       "Готово",
+			"Fail":                       "Ошибка",
+			"Daemon is already running.": "Демон уже запущен.",
+			"Daemon stopped.":            "Демон остановлен.",
+		},
+	},
+	"uk": {
+		Lang: "uk",
+		Texts: map[string]string{
+			// status messages: the known line prefixes are translated, the rest of line is kept
+			"Synchronization core status: ":          "Статус ядра синхронізації: ",
+			"Path to Yandex.Disk directory: ":        "Шлях до теки Яндекс.Диска: ",
+			"Total: ":                                "Всього: ",
+			"Used: ":                                 "Використано: ",
+			"Available: ":                            "Вільно: ",
+			"Max file size: ":                        "Максимальний розмір файлу: ",
+			"Trash size: ":                           "Розмір кошика: ",
+			"Last synchronized items:":               "Останні синхронізовані елементи:",
+			"Last synchronized files:":               "Останні синхронізовані файли:",
+			"file: ":                                 "файл: ",
+			"Sync progress: ":                        "Прогрес синхронізації: ",
+			"The quota has not been received yet.":   "Інформацію про квоту ще не отримано.",
+			"Quota information is not received yet.": "Інформацію про квоту ще не отримано.",
+			"Path: ":                                 "Шлях: ",
+			"access error":                           "помилка доступу",
+			"Error: ":                                "Помилка: ",
+			// errors
+			"Error: command hasn't been specified. Use the --help command to access help\nor setup to launch the setup wizard.": "Помилка: команду не вказано. Використайте команду --help для отримання довідки\nабо setup для запуску майстра налаштування.",
+			"Error: daemon not started":                 "Помилка: демон не запущено",
+			"Error: daemon is not running":              "Помилка: демон не запущено",
+			"Error: unknown command:":                   "Помилка: невідома команда:",
+			"Error: unknown option:":                    "Помилка: невідомий параметр:",
+			"Error: option 'dir' is missing":            "Помилка: відсутній параметр 'dir'",
+			"Error: Indicated directory does not exist": "Помилка: вказана тека не існує",
+			"Error: indicated directory does not exist": "Помилка: вказана тека не існує",
+		},
+		Messages: map[string]string{
+			"Starting daemon process...": "Запуск демона...",
+			"Done":                       "Готово",
+			"Fail":                       "Помилка",
+			"Daemon is already running.": "Демон вже запущено.",
+			"Daemon stopped.":            "Демон зупинено.",
+		},
+	},
+}
+
+// LocaleCatalog returns the message catalog of the locale (LC_ALL, LC_MESSAGES or LANG
+// value, e.g. "ru_RU.UTF-8"). It returns nil for English and unknown languages.
+func LocaleCatalog(locale string) *Catalog {
+	lang, _, _ := strings.Cut(locale, "_")
+	lang, _, _ = strings.Cut(lang, ".")
+	return Catalogs[lang]
+}
+
+// Text returns the translated status message or error. The whole known texts and the
+// known line prefixes are translated; the rest of line (state, path, file name) is kept
+// as it is except the known error text after "Error: ".
+func (c *Catalog) Text(s string) string {
+	if c == nil {
+		return s
+	}
+	if t, ok := c.Texts[s]; ok {
+		return t
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = c.line(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// line returns the translated line of message. The line indentation is kept.
+func (c *Catalog) line(l string) string {
+	text := strings.TrimLeft(l, "\t")
+	indent := l[:len(l)-len(text)]
+	if t, ok := c.Texts[text]; ok {
+		return indent + t
+	}
+	prefix := ""
+	for k := range c.Texts {
+		if strings.HasSuffix(strings.TrimSuffix(k, " "), ":") && strings.HasPrefix(text, k) && len(k) > len(prefix) {
+			prefix = k
+		}
+	}
+	if prefix == "" {
+		return l
+	}
+	rest := text[len(prefix):]
+	if t, ok := c.Texts[rest]; ok && prefix == "Error: " {
+		rest = t
+	}
+	return indent + c.Texts[prefix] + rest
+}
+
+// Message returns the translated start/stop message
+func (c *Catalog) Message(s string) string {
+	if c == nil {
+		return s
+	}
+	if t, ok := c.Messages[s]; ok {
+		return t
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// ChaosSet is the name of chaos simulation set
+	ChaosSet = "Chaos"
+	// number of random transitions in chaos simulation
+	chaosLength = 20
+	// minimal and maximal durations of chaos simulation events
+	chaosMinDuration = 100 * time.Millisecond
+	chaosMaxDuration = 2000 * time.Millisecond
+)
+
+var (
+	// states of chaos simulation
+	chaosStates = []string{"idle", "index", "busy", "error", "paused", "no internet access"}
+	// errors of chaos simulation error state
+	chaosErrors = []string{"access error", "no internet access", "disk is full"}
+	// paths of chaos simulation errors
+	chaosPaths = []string{"downloads/test1", "File.ods", "downloads/file.deb", "very_very_long_long_file_with_underscore"}
+)
+
+// chaosEvents returns the random events sequence generated by the seed.
+// The same seed always gives the same sequence.
+func chaosEvents(seed int64) []event {
+	r := rand.New(rand.NewSource(seed))
+	events := make([]event, chaosLength)
+	for i := range events {
+		state := chaosStates[r.Intn(len(chaosStates))]
+		events[i] = event{
+			msg:      chaosMsg(r, state),
+			duration: chaosMinDuration + time.Duration(r.Int63n(int64(chaosMaxDuration-chaosMinDuration))),
+			logMsg:   fmt.Sprintf("Chaos simulation %d: %s", i+1, state),
+		}
+	}
+	events[0].logMsg = fmt.Sprintf("Chaos simulation started (seed %d)", seed)
+	return events
+}
+
+// chaosMsg returns the status message of the state with random progress or error values
+func chaosMsg(r *rand.Rand, state string) string {
+	var b strings.Builder
+	if state == "busy" || state == "index" && r.Intn(2) == 0 {
+		total := float64(r.Intn(100000)+1) / 100
+		done := total * float64(r.Intn(101)) / 100
+		fmt.Fprintf(&b, "Sync progress: %.2f MB/ %.2f MB (%d %%)\n", done, total, int(done*100/total))
+	}
+	b.WriteString(statePrefix + state + "\n")
+	if state == "error" {
+		fmt.Fprintf(&b, "Error: %s\nPath: '%s'\n", chaosErrors[r.Intn(len(chaosErrors))], chaosPaths[r.Intn(len(chaosPaths))])
+	}
+	b.WriteString(msgTail())
+	return b.String()
+}
+
+// msgTail returns the rest of status message after the status and error lines
+// (directory, quota and last synchronized items): it is the same as in idle message
+func msgTail() string {
+	_, rest, _ := strings.Cut(msgIdle, "\n")
+	return rest
+}
+
+// SimulateChaos starts the chaos simulation: random walk through the daemon states
+// with random durations and progress values generated by the seed. The seed is
+// written into simulator log to make possible the exact reproduction of simulation.
+func (s *Simulator) SimulateChaos(ctx context.Context, seed int64) error {
+	s.Log.Printf("%s simulation seed: %d", ChaosSet, seed)
+	return s.run(ctx, ChaosSet, s.policy(ChaosSet), slices.Values(chaosEvents(seed)))
+}
@@ -0,0 +1,56 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrStopped is returned by Command when the daemon closes the connection without
+// any reply. It happens when the daemon is stopped.
+var ErrStopped = errors.New("daemon stopped")
+
+// Dial connects to the daemon socket and sends the command with its arguments.
+// The reply has to be read from returned connection.
+func Dial(socket, cmd string, args ...string) (net.Conn, error) {
+	// open socket as client
+	conn, err := net.DialTimeout("unix", socket, time.Duration(time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("socket dial error: %w", err)
+	}
+	// send cmd with its arguments to socket
+	if _, err = conn.Write([]byte(strings.Join(append([]string{cmd}, args...), " "))); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socket write error: %w", err)
+	}
+	return conn, nil
+}
+
+// Command sends the command with its arguments to the daemon and returns the reply.
+// The error reply of the daemon is returned as error, the empty reply is returned
+// as ErrStopped.
+func Command(socket, cmd string, args ...string) (string, error) {
+	conn, err := Dial(socket, cmd, args...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	// read response
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("socket read error: %w ", err)
+	}
+	m := string(reply)
+	switch {
+	case len(reply) == 0: // closed socket mean that daemon was stopped
+		return "", ErrStopped
+	case len(reply) == 1: // just a sign that daemon is active
+		return "", nil
+	case strings.HasPrefix(m, "Error:"): // errors from daemon
+		return "", errors.New(m)
+	}
+	return m, nil
+}
@@ -0,0 +1,92 @@
+package simulator
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// time format of cli.log entries
+const cliLogTime = "2006-01-02 15:04:05.000"
+
+// entries returns the cli.log entries of transition from the prev status message to the
+// event message in the format of original daemon: "<date> <time> <LEVEL> <text>".
+// The entries report the changes of core status, sync progress and error, the synchronized
+// files and the additional entry of event.
+func (s *Simulator) entries(prev string, e event) []string {
+	next := cmp.Or(e.msg, prev)
+	now := s.Clock.Now().Format(cliLogTime)
+	var res []string
+	add := func(level, text string) {
+		res = append(res, fmt.Sprintf("%s %-5s %s", now, level, text))
+	}
+	if state := stateOf(next); state != "" && state != stateOf(prev) {
+		add("INFO", statePrefix+state)
+	}
+	if progress := lineOf(next, "Sync progress: "); progress != "" && progress != lineOf(prev, "Sync progress: ") {
+		add("INFO", "Sync progress: "+progress)
+	}
+	if msg := lineOf(next, "Error: "); msg != "" && (msg != lineOf(prev, "Error: ") || stateOf(prev) != "error") {
+		if path := lineOf(next, "Path: "); path != "" {
+			msg += ": " + path
+		}
+		add("ERROR", msg)
+	}
+	direction := "Uploaded"
+	if s.Mode == ModeOverwrite {
+		direction = "Downloaded"
+	}
+	for _, f := range newItems(prev, next) {
+		add("INFO", fmt.Sprintf("%s file: '%s'", direction, f))
+	}
+	if e.entry != "" {
+		level, text, _ := strings.Cut(e.entry, " ")
+		add(level, text)
+	}
+	return res
+}
+
+// lineOf returns the rest of the first message line that begins with the prefix
+// or "" when there is no such line
+func lineOf(msg, prefix string) string {
+	for _, l := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(l, prefix) {
+			return strings.TrimPrefix(l, prefix)
+		}
+	}
+	return ""
+}
+
+// itemsOf returns the file names from the last synchronized items of message and
+// false when the message has no last synchronized items
+func itemsOf(msg string) ([]string, bool) {
+	_, list, found := strings.Cut(msg, "Last synchronized items:\n")
+	if !found {
+		return nil, false
+	}
+	var items []string
+	for _, l := range strings.Split(list, "\n") {
+		if name, ok := strings.CutPrefix(l, "\tfile: "); ok {
+			items = append(items, strings.Trim(name, "'"))
+		}
+	}
+	return items, true
+}
+
+// newItems returns the last synchronized items of the next message that precede the
+// items known from the prev message: the newly synchronized files are added at the top
+// of list. Nothing is new when the prev message has no last synchronized items.
+func newItems(prev, next string) []string {
+	old, ok := itemsOf(prev)
+	if !ok {
+		return nil
+	}
+	items, _ := itemsOf(next)
+	for i, item := range items {
+		if slices.Contains(old, item) {
+			return items[:i]
+		}
+	}
+	return items
+}
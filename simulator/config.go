@@ -0,0 +1,36 @@
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// ConfigFileName is the name of yandex-disk configuration file
+const ConfigFileName = "config.cfg"
+
+// Setup creates the configuration file and the file with token in the configuration
+// path and the synchronized directory
+func Setup(cfgPath, syncPath string) error {
+	if err := os.MkdirAll(cfgPath, 0750); err != nil {
+		return fmt.Errorf("config path creation error: %w", err)
+	}
+	// create the token file
+	auth := path.Join(cfgPath, "passwd")
+	if notExists(auth) {
+		if err := os.WriteFile(auth, []byte("token"), 0600); err != nil {
+			return fmt.Errorf("yandex-disk token file '%s' writing error: %w", auth, err)
+		}
+	}
+	// create the configuration file and write the configuration values in it
+	cfg := path.Join(cfgPath, ConfigFileName)
+	err := os.WriteFile(cfg, []byte("proxy=\"no\"\n\nauth=\""+auth+"\"\ndir=\""+syncPath+"\"\n\n"), 0600)
+	if err != nil {
+		return fmt.Errorf("config file '%s' writing error: %w", cfg, err)
+	}
+	// create the folder for synchronisation
+	if err = os.MkdirAll(syncPath, 0750); err != nil {
+		return fmt.Errorf("synchronization Dir '%s' creation error: %w", syncPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// exit code of crashed daemon
+const crashExitCode = 1
+
+// ErrCrashed is returned by Serve when the daemon crashed by the crash command and
+// the injected Exit function returned
+var ErrCrashed = errors.New("daemon crashed")
+
+// crash signals by names
+var crashSignals = map[string]syscall.Signal{
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+}
+
+// Crash - the abnormal exit of the daemon
+type Crash struct {
+	KeepSocket bool           // leave the socket file that refuses the connections
+	Truncate   bool           // leave the truncated line at the end of cli.log
+	Signal     syscall.Signal // exit by the signal (0 - exit with code 1)
+}
+
+// String returns the crash description, e.g. "exit code 1, socket file is kept"
+func (c Crash) String() string {
+	parts := []string{fmt.Sprintf("exit code %d", crashExitCode)}
+	if c.Signal != 0 {
+		parts[0] = "signal " + c.Signal.String()
+	}
+	if c.KeepSocket {
+		parts = append(parts, "socket file is kept")
+	}
+	if c.Truncate {
+		parts = append(parts, "cli.log is truncated")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// crash makes the abnormal daemon exit: the running simulations are interrupted without
+// the stop simulation and the connections are closed without reply
+func (d *Daemon) crash(c Crash) {
+	d.log.Println("Daemon crashed:", c)
+	d.sim.halt()
+	if c.Truncate {
+		// the line is interrupted in the middle as the writing would be
+		line := fmt.Sprintf("%s %-5s %s", d.sim.Clock.Now().Format(cliLogTime), "INFO", statePrefix+d.sim.State())
+		d.CliLog.Write([]byte(line[:len(line)/2]))
+	}
+	if ln, ok := d.Listener.(*net.UnixListener); ok && c.KeepSocket {
+		ln.SetUnlinkOnClose(false)
+		d.keepSocket = true
+	}
+	d.Listener.Close()
+	if d.Exit == nil {
+		exitProcess(c)
+	}
+	d.Exit(c)
+	d.finish(ErrCrashed)
+}
+
+// exitProcess terminates the process by the signal or with crash exit code
+func exitProcess(c Crash) {
+	if c.Signal != 0 {
+		// the default signal action terminates the process
+		signal.Reset(c.Signal)
+		syscall.Kill(os.Getpid(), c.Signal)
+		// the signal is delivered asynchronously
+		time.Sleep(time.Second)
+	}
+	os.Exit(crashExitCode)
+}
+
+// parseCrashArgs returns the crash from the crash command arguments:
+// [--keep-socket] [--truncate] [--signal <KILL|TERM|INT|HUP>]
+func parseCrashArgs(args []string) (Crash, error) {
+	var c Crash
+	for i := 0; i < len(args); i++ {
+		// the flags are checked first as optionValue takes the next argument as value
+		switch args[i] {
+		case "--keep-socket":
+			c.KeepSocket = true
+			continue
+		case "--truncate":
+			c.Truncate = true
+			continue
+		}
+		name, value, ok := optionValue(args, &i)
+		switch {
+		case ok && name == "--signal":
+			sig, found := crashSignals[strings.TrimPrefix(strings.ToUpper(value), "SIG")]
+			if !found {
+				return Crash{}, fmt.Errorf("unknown signal '%s': KILL, TERM, INT or HUP expected", value)
+			}
+			c.Signal = sig
+		default:
+			return Crash{}, fmt.Errorf("unexpected crash argument '%s'", args[i])
+		}
+	}
+	return c, nil
+}
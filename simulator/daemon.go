@@ -0,0 +1,579 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logDirName   = ".sync"
+	logFileName  = "cli.log"
+	waitTimeout  = 10 * time.Second // default timeout of wait command
+	waitFinished = "finished"       // wait command state to wait for the end of all simulations
+	maxCommand   = 8192             // maximal size of command with arguments (e.g. long file paths)
+)
+
+// Daemon - the simulated yandex-disk daemon. It serves the commands received via unix socket.
+// The Listener and CliLog can be injected, other ways they are opened by Listen using
+// Socket and SyncDir paths. The simulator log and clock are injected via Options.
+// The HTTP control server is served as well when the HTTP address is set. The process
+// exit on the crash command can be replaced by injected Exit function. The OAuth token
+// is checked by CheckToken and by the token command when the valid Token is set.
+type Daemon struct {
+	SyncDir  string       // synchronized directory path
+	Socket   string       // unix socket path (used when Listener is nil)
+	Listener net.Listener // listener of incoming connections
+	CliLog   io.Writer    // daemon's synchronization log (cli.log in SyncDir when it is nil)
+	HTTP     string       // HTTP control server address: "host:port" or unix socket path ("" - no server)
+	Options  Options      // simulation options
+	Exit     func(Crash)  // replaces the process exit on crash command (nil - the process exits)
+
+	TokenFile   string        // OAuth token file path
+	Token       string        // valid OAuth token ("" - any token is valid)
+	TokenExpiry time.Duration // token lifetime since the start or the token command (0 - endless)
+
+	sim        *Simulator    // simulator engine
+	logFile    *logFile      // opened cli.log
+	ownLn      bool          // listener was opened by Listen
+	keepSocket bool          // socket file is left by crash
+	httpLn     net.Listener  // listener of HTTP control server
+	done       chan error    // receives the serving result
+	quit       chan struct{} // closed when the serving is finished
+	log        *log.Logger   // simulator log
+	faults     faults        // injected faults of replies
+
+	tokenCancel context.CancelFunc // cancels the current token lifetime
+	tokenLock   sync.Mutex         // token lifetime lock
+}
+
+// CliLogPath returns the path of daemon's synchronization log (cli.log)
+func CliLogPath(syncDir string) string {
+	return path.Join(os.ExpandEnv(syncDir), logDirName, logFileName)
+}
+
+// notExists returns true when specified file or path is not exists
+func notExists(somePath string) bool {
+	if _, err := os.Stat(somePath); err != nil {
+		return !errors.Is(err, os.ErrExist)
+	}
+	return false
+}
+
+// Listen prepares the daemon for serving: it opens the daemon's synchronization log
+// and the listening socket when they are not injected and creates the simulator engine,
+// so Stop can be called before Serve. Call Close to release them.
+func (d *Daemon) Listen() error {
+	d.Options = d.Options.withDefaults()
+	d.log = d.Options.Log
+	d.done = make(chan error, 1)
+	d.quit = make(chan struct{})
+	var err error
+	if d.CliLog == nil {
+		// open daemon's synchronization log file (its path is created if it is not exists)
+		if d.logFile, err = openLogFile(CliLogPath(d.SyncDir), d.log); err != nil {
+			return err
+		}
+		d.CliLog = d.logFile
+	}
+	if d.Listener == nil {
+		// open listening socket as server
+		if d.Listener, err = net.Listen("unix", d.Socket); err != nil {
+			if d.logFile != nil {
+				d.logFile.Close()
+			}
+			return handleErr(d.log, "socket listener creation error: %w", err)
+		}
+		d.ownLn = true
+	}
+	if d.HTTP != "" {
+		if d.httpLn, err = listenHTTP(d.HTTP); err != nil {
+			d.Close()
+			return handleErr(d.log, "HTTP listener creation error: %w", err)
+		}
+	}
+	// create new simulator engine
+	d.sim = NewSimulator(d.CliLog, d.Options)
+	return nil
+}
+
+// Close closes the listeners and removes the socket file when they were opened by Listen
+// and closes the daemon's synchronization log when it was opened by Listen.
+func (d *Daemon) Close() {
+	if d.ownLn {
+		d.Listener.Close()
+		if !d.keepSocket {
+			os.Remove(d.Socket)
+		}
+	}
+	if d.httpLn != nil {
+		d.httpLn.Close()
+	}
+	if d.logFile != nil {
+		d.logFile.Close()
+	}
+}
+
+// Serve begins the start simulation and handles incoming connections until the
+// stop command is received, Stop is called or the first handling error happens.
+// Listen must be called before Serve. The injected listener is closed by Serve.
+func (d *Daemon) Serve() error {
+	d.log.Println("Daemon started in mode:", syncSets[d.Options.Mode])
+	defer d.log.Println("Daemon stopped")
+
+	// NOTE! All error after disconection from parent must be writen into simulator log
+	// as there is no other way to report about a problems in daemon mode.
+	// Use handleErr() to do so.
+
+	defer d.sim.Close()
+	// begin simulation of initial synchronisation
+	d.sim.Simulate("Start")
+	d.expireToken()
+
+	if d.httpLn != nil {
+		// the requests context is cancelled on shutdown to finish the events streams
+		ctx, cancel := context.WithCancel(context.Background())
+		srv := &http.Server{Handler: d.httpHandler(), ErrorLog: d.log, BaseContext: func(net.Listener) context.Context { return ctx }}
+		srv.RegisterOnShutdown(cancel)
+		go func() {
+			if err := srv.Serve(d.httpLn); !errors.Is(err, http.ErrServerClosed) {
+				d.finish(handleErr(d.log, "HTTP serving error: %w", err))
+			}
+		}()
+		// the replies of handled requests (e.g. stop) are completed before exit
+		defer srv.Shutdown(context.Background())
+		d.log.Println("HTTP control server listens on:", d.httpLn.Addr())
+	}
+
+	// main daemon loop
+	// connections are handled concurrently as some commands (e.g. wait) can take a long time.
+	// The loop is finished by the stop command or by the first handling error.
+	go func() {
+		for {
+			// accept connection to socket
+			conn, err := d.Listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					d.finish(handleErr(d.log, "accepting connection error: %w", err))
+				}
+				return
+			}
+
+			// handle received connection
+			go func() {
+				exit, err := d.handleConnection(conn)
+				if err != nil {
+					d.finish(handleErr(d.log, "connection handling error: %w", err))
+				} else if exit {
+					d.finish(nil)
+				}
+			}()
+		}
+	}()
+	err := <-d.done
+	d.Listener.Close()
+	close(d.quit)
+	var stats strings.Builder
+	WriteStats(&stats, d.sim.Stats())
+	d.log.Print("Commands statistics:\n", stats.String())
+	return err
+}
+
+// finish finishes the serving with the result; only the first result is used
+func (d *Daemon) finish(err error) {
+	select {
+	case d.done <- err:
+	default:
+	}
+}
+
+// Stop simulates the normal daemon exit like the stop command does and finishes the serving
+func (d *Daemon) Stop() {
+	d.stop()
+	d.finish(nil)
+}
+
+// stop simulates the normal daemon exit
+func (d *Daemon) stop() {
+	d.sim.Simulate("Stop")
+	<-d.sim.Clock.After(Scale(stopTime, d.sim.Scale))
+}
+
+// handleConnection reads the command from connection, perform required operation,
+// and sends back the response on command through the same connection.
+// It returns error and stop flag that instruct the main daemon loop to continue or to stop.
+func (d *Daemon) handleConnection(conn net.Conn) (bool, error) {
+	defer conn.Close()
+	sim := d.sim
+
+	// read command and its arguments: the client writes them by one write, so the command
+	// that doesn't fit into the buffer is longer than allowed
+	buf := make([]byte, maxCommand+1)
+	nr, err := conn.Read(buf)
+	if err != nil {
+		return true, fmt.Errorf("connection reading error: %w", err)
+	}
+	if nr > maxCommand {
+		sim.Log.Println("Received too long command")
+		// the rest of command is read out as the connection with unread data is reset on close
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		io.Copy(io.Discard, conn)
+		if _, err = fmt.Fprintf(conn, "Error: command is longer than %d bytes", maxCommand); err != nil {
+			return true, fmt.Errorf("writing to connecton error: %w", err)
+		}
+		return false, nil // continue accepting of incoming connections
+	}
+	sim.Log.Println("Received:", string(buf[0:nr]))
+	args := strings.Fields(string(buf[0:nr]))
+	var cmd string
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	// check the synchronization path existence and return error in case of absence of it
+	if notExists(d.SyncDir) && cmd != "stop" {
+		if _, err = conn.Write([]byte(d.Options.Profile.Text("Error: Indicated directory does not exist"))); err != nil {
+			return true, fmt.Errorf("writing to connecton error: %w", err)
+		}
+		return false, nil // continue accepting of incoming connections
+	}
+	sim.CountCommand(cmd)
+	// the commands that only read the daemon state aren't kept in history
+	if !slices.Contains([]string{"status", "watch", "history"}, cmd) {
+		sim.LogCommand(strings.Join(append([]string{cmd}, args...), " "))
+	}
+	// the fault command isn't faulted to keep the faults under control
+	if cmd != "fault" {
+		if conn = d.injectFault(cmd, conn); conn == nil {
+			return false, nil // connection is closed without reply
+		}
+	}
+	// handle command and send back the command execution results
+	switch cmd {
+	case "status": // reply into socket by current message
+		_, err = conn.Write([]byte(sim.GetMessage()))
+	case "sync": // begin the synchronization simulation
+		err = sim.Simulate("Synchronization")
+		_, err = conn.Write(simReply(err))
+	case "error": // switch to error state
+		err = sim.Simulate("Error")
+		_, err = conn.Write(simReply(err))
+	case "chaos": // begin the chaos simulation with given or random seed
+		var seed int64
+		if seed, err = parseChaosArgs(args); err != nil {
+			_, err = conn.Write([]byte("Error: " + err.Error()))
+			break
+		}
+		err = sim.SimulateChaos(context.Background(), seed)
+		_, err = conn.Write(simReply(err))
+	case "markov": // begin the Markov scenario simulation
+		var m *Markov
+		var seed int64
+		if m, seed, err = parseMarkovArgs(args); err != nil {
+			_, err = conn.Write([]byte("Error: " + err.Error()))
+			break
+		}
+		err = sim.SimulateMarkov(context.Background(), m, seed)
+		_, err = conn.Write(simReply(err))
+	case "replay": // begin the simulation of recorded scenario
+		if len(args) != 1 {
+			_, err = conn.Write([]byte("Error: recording file hasn't been specified"))
+			break
+		}
+		var r *Recording
+		if r, err = LoadRecording(args[0]); err != nil {
+			_, err = conn.Write([]byte("Error: " + err.Error()))
+			break
+		}
+		err = sim.SimulateReplay(context.Background(), r)
+		_, err = conn.Write(simReply(err))
+	case "progress": // begin the busy status with the sync progress percent
+		var percent int
+		if percent, err = parseProgressArgs(args); err != nil {
+			_, err = conn.Write([]byte("Error: " + err.Error()))
+			break
+		}
+		err = sim.SimulateProgress(context.Background(), percent)
+		_, err = conn.Write(simReply(err))
+	case "network": // toggle the network loss
+		_, err = sim.ToggleNetwork(context.Background())
+		_, err = conn.Write(simReply(err))
+	case "step": // make the next transition in stepping mode and reply by new status message
+		switch {
+		case !sim.Stepping:
+			_, err = conn.Write([]byte("Error: daemon is not in step mode"))
+		case !sim.Step():
+			_, err = conn.Write([]byte("Error: there is no simulation to step"))
+		default:
+			_, err = conn.Write([]byte(sim.GetMessage()))
+		}
+	case "wait": // wait for the state and reply by the status message
+		var state string
+		var timeout time.Duration
+		if state, timeout, err = parseWaitArgs(args); err != nil {
+			_, err = conn.Write([]byte("Error: " + err.Error()))
+			break
+		}
+		var reached bool
+		if state == waitFinished {
+			reached = sim.WaitFinished(timeout)
+		} else {
+			reached = sim.WaitState(state, timeout)
+		}
+		if !reached {
+			_, err = conn.Write([]byte(fmt.Sprintf("Error: '%s' state hasn't been reached within %v", state, timeout)))
+			break
+		}
+		_, err = conn.Write([]byte(sim.GetMessage()))
+	case "watch": // stream updates as JSON lines until the daemon stops or client disconnects
+		updates, cancel := sim.Subscribe()
+		defer cancel()
+		enc := json.NewEncoder(conn)
+		if err = enc.Encode(Update{Time: sim.Clock.Now(), Type: "status", State: sim.State(), Message: sim.GetMessage()}); err != nil {
+			return false, nil // client has gone
+		}
+		// the connection closing (by client or by partial reply fault) is detected by reading
+		gone := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, conn)
+			close(gone)
+		}()
+		for {
+			select {
+			case u, ok := <-updates:
+				if !ok {
+					return false, nil // simulator is closed
+				}
+				if enc.Encode(u) != nil {
+					return false, nil // client has gone
+				}
+			case <-gone:
+				return false, nil // client has gone
+			}
+		}
+	case "history": // reply by the history timeline or by the history as JSON Lines
+		var b bytes.Buffer
+		switch {
+		case len(args) == 0:
+			WriteTimeline(&b, sim.History())
+		case len(args) == 1 && args[0] == "--jsonl":
+			WriteJSONLines(&b, sim.History())
+		default:
+			fmt.Fprintf(&b, "Error: unexpected history argument '%s'", args[0])
+		}
+		// the last line is replied without line end like the status message
+		reply := bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+		if len(reply) == 0 {
+			reply = simReply(nil)
+		}
+		_, err = conn.Write(reply)
+	case "stats": // reply by the statistics of received commands as text or JSON
+		var b bytes.Buffer
+		switch {
+		case len(args) == 0:
+			WriteStats(&b, sim.Stats())
+		case len(args) == 1 && args[0] == "--json":
+			json.NewEncoder(&b).Encode(sim.Stats())
+		default:
+			fmt.Fprintf(&b, "Error: unexpected stats argument '%s'", args[0])
+		}
+		_, err = conn.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	case "fault": // set, remove or reply by the faults of replies
+		var b bytes.Buffer
+		switch {
+		case len(args) == 0:
+			writeFaults(&b, d.Faults())
+		case len(args) == 1 && args[0] == "off":
+			d.faults.clear()
+		default:
+			var fc string
+			var f Fault
+			if fc, f, err = parseFaultArgs(args); err == nil {
+				err = d.SetFault(fc, f)
+			}
+			if err != nil {
+				b.WriteString("Error: " + err.Error())
+			}
+		}
+		reply := bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+		if len(reply) == 0 {
+			reply = simReply(nil)
+		}
+		_, err = conn.Write(reply)
+	case "token": // check the renewed token and recover from authorization error
+		if err = d.CheckToken(); err == nil {
+			err = d.renewToken()
+		}
+		_, err = conn.Write(simReply(err))
+	case "crash": // exit abruptly without reply
+		var c Crash
+		if c, err = parseCrashArgs(args); err != nil {
+			_, err = conn.Write([]byte("Error: " + err.Error()))
+			break
+		}
+		d.crash(c)
+		return true, nil // stop accepting of incoming connections
+	case "stop": // stop the daemon
+		// send back nothing to show that daemon is not active any more
+		// simulate normal exit
+		d.stop()
+		return true, nil // stop accepting of incoming connections
+	default:
+		// unexpected command
+		return true, fmt.Errorf("command handling error: unexpected command '%s' received", cmd)
+	}
+	// handle all connection writing errors in switch here
+	if err != nil {
+		return true, fmt.Errorf("writing to connection error: %w", err)
+	}
+	return false, nil // continue accepting of incoming connections
+}
+
+// simReply returns the reply on simulation command: the error message when the
+// simulation isn't started or zero byte to show that daemon still active
+func simReply(err error) []byte {
+	if err != nil {
+		return []byte("Error: " + err.Error())
+	}
+	return []byte{0}
+}
+
+// parseWaitArgs returns the awaited state and timeout from the wait command arguments:
+// <state> [--timeout <duration>]. The "no internet access" state is the only one of
+// several words as the command arguments are split by spaces.
+func parseWaitArgs(args []string) (string, time.Duration, error) {
+	var words []string
+	timeout := waitTimeout
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--timeout" && i+1 < len(args):
+			i++
+			a = "--timeout=" + args[i]
+			fallthrough
+		case strings.HasPrefix(a, "--timeout="):
+			d, err := time.ParseDuration(strings.TrimPrefix(a, "--timeout="))
+			if err != nil || d <= 0 {
+				return "", 0, fmt.Errorf("incorrect timeout value '%s'", strings.TrimPrefix(a, "--timeout="))
+			}
+			timeout = d
+		case !strings.HasPrefix(a, "-"):
+			words = append(words, a)
+		default:
+			return "", 0, fmt.Errorf("unexpected wait argument '%s'", a)
+		}
+	}
+	state := strings.Join(words, " ")
+	switch {
+	case state == "":
+		return "", 0, fmt.Errorf("%s", "state to wait for hasn't been specified")
+	case len(words) > 1 && state != offlineState:
+		return "", 0, fmt.Errorf("unexpected wait argument '%s'", words[1])
+	}
+	return state, timeout, nil
+}
+
+// parseChaosArgs returns the chaos simulation seed from the chaos command arguments:
+// [--seed <number>]. The random seed is returned when it isn't specified.
+func parseChaosArgs(args []string) (int64, error) {
+	seed := time.Now().UnixNano()
+	for i := 0; i < len(args); i++ {
+		name, value, ok := optionValue(args, &i)
+		switch {
+		case ok && name == "--seed":
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("incorrect seed value '%s'", value)
+			}
+			seed = v
+		default:
+			return 0, fmt.Errorf("unexpected chaos argument '%s'", args[i])
+		}
+	}
+	return seed, nil
+}
+
+// parseProgressArgs returns the percent from the progress command arguments: <percent>
+func parseProgressArgs(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("progress percent hasn't been specified")
+	}
+	percent, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("incorrect progress value '%s': 0..100 expected", args[0])
+	}
+	return percent, nil
+}
+
+// parseMarkovArgs returns the scenario and the seed from the markov command arguments:
+// [--seed <number>] [--steps <number>] [<scenario file>]. The built-in SoakScenario
+// is returned when the file isn't specified, the random seed is returned when the seed
+// isn't specified.
+func parseMarkovArgs(args []string) (*Markov, int64, error) {
+	seed := time.Now().UnixNano()
+	steps := -1
+	file := ""
+	for i := 0; i < len(args); i++ {
+		name, value, ok := optionValue(args, &i)
+		switch {
+		case ok && name == "--seed":
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("incorrect seed value '%s'", value)
+			}
+			seed = v
+		case ok && name == "--steps":
+			v, err := strconv.Atoi(value)
+			if err != nil || v < 0 {
+				return nil, 0, fmt.Errorf("incorrect steps value '%s'", value)
+			}
+			steps = v
+		case !ok && file == "" && !strings.HasPrefix(args[i], "-"):
+			file = args[i]
+		default:
+			return nil, 0, fmt.Errorf("unexpected markov argument '%s'", args[i])
+		}
+	}
+	m := *SoakScenario
+	if file != "" {
+		loaded, err := LoadMarkov(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		m = *loaded
+	}
+	if steps >= 0 {
+		m.Steps = steps
+	}
+	return &m, seed, nil
+}
+
+// optionValue returns the name and value of the option at args[*i] in forms
+// --name=value or --name value (*i is moved to the value). ok is false when the
+// argument at args[*i] isn't an option with value.
+func optionValue(args []string, i *int) (name, value string, ok bool) {
+	a := args[*i]
+	if !strings.HasPrefix(a, "--") {
+		return "", "", false
+	}
+	if name, value, ok = strings.Cut(a, "="); ok {
+		return name, value, true
+	}
+	if *i+1 < len(args) {
+		*i++
+		return a, args[*i], true
+	}
+	return "", "", false
+}
@@ -0,0 +1,694 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// send the command to simulator via handleConnection and return the reply
+func sendCommand(t *testing.T, sim *Simulator, cmd string) string {
+	client, server := net.Pipe()
+	defer client.Close()
+	d := &Daemon{SyncDir: t.TempDir(), sim: sim}
+	go d.handleConnection(server)
+	_, err := client.Write([]byte(cmd))
+	require.NoError(t, err)
+	res, err := io.ReadAll(client)
+	require.NoError(t, err)
+	return string(res)
+}
+
+// try to go through the start and synchronization simulations in step mode
+func TestHandleConnectionStepping(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 1, Stepping: true})
+	sim.Simulate("Start")
+
+	// no transitions without step
+	require.Equal(t, " ", sendCommand(t, sim, "status"))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, " ", sendCommand(t, sim, "step"))
+	for _, state := range []string{"paused", "index", "busy", "index", "idle"} {
+		require.Contains(t, sendCommand(t, sim, "step"), "Synchronization core status: "+state+"\n")
+		require.Contains(t, sendCommand(t, sim, "status"), "Synchronization core status: "+state+"\n")
+	}
+	require.Equal(t, "Error: there is no simulation to step", sendCommand(t, sim, "step"))
+
+	sendCommand(t, sim, "sync")
+	require.Contains(t, sendCommand(t, sim, "status"), "Synchronization core status: idle\n")
+	for _, state := range []string{"index", "busy", "busy", "index", "idle"} {
+		require.Contains(t, sendCommand(t, sim, "step"), "Synchronization core status: "+state+"\n")
+	}
+	require.Equal(t, "Error: there is no simulation to step", sendCommand(t, sim, "step"))
+}
+
+// try to wait for states of accelerated start simulation
+func TestHandleConnectionWait(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 0.01})
+	sim.Simulate("Start")
+	require.Contains(t, sendCommand(t, sim, "wait busy"), "Synchronization core status: busy\n")
+	require.Contains(t, sendCommand(t, sim, "wait --timeout=2s idle"), "Synchronization core status: idle\n")
+	require.Contains(t, sendCommand(t, sim, "wait finished --timeout 1s"), "Synchronization core status: idle\n")
+	require.Equal(t, "Error: 'error' state hasn't been reached within 50ms", sendCommand(t, sim, "wait error --timeout 50ms"))
+	require.Equal(t, "Error: incorrect timeout value 'soon'", sendCommand(t, sim, "wait idle --timeout soon"))
+	require.Equal(t, "Error: state to wait for hasn't been specified", sendCommand(t, sim, "wait --timeout 1s"))
+	require.Equal(t, "Error: unexpected wait argument 'busy'", sendCommand(t, sim, "wait idle busy"))
+	_, err := sim.ToggleNetwork(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, sendCommand(t, sim, "wait no internet access --timeout 1s"), "Synchronization core status: no internet access\n")
+}
+
+// try to watch the updates during the error simulation
+func TestHandleConnectionWatch(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 0.01})
+	client, server := net.Pipe()
+	defer client.Close()
+	d := &Daemon{SyncDir: t.TempDir(), sim: sim}
+	go d.handleConnection(server)
+	_, err := client.Write([]byte("watch"))
+	require.NoError(t, err)
+	dec := json.NewDecoder(client)
+	next := func() Update {
+		var u Update
+		require.NoError(t, dec.Decode(&u))
+		return u
+	}
+	u := next()
+	require.Equal(t, "status", u.Type)
+	require.Equal(t, " ", u.Message)
+	sim.Simulate("Error")
+	for _, exp := range []Update{
+		{Type: "status", State: "error"},
+		{Type: "log", Message: " INFO  Synchronization core status: error"},
+		{Type: "log", Message: " ERROR access error: 'downloads/test1'"},
+		{Type: "status", State: "idle", Message: msgIdle},
+		{Type: "log", Message: " INFO  Synchronization core status: idle"},
+	} {
+		u = next()
+		require.Equal(t, exp.Type, u.Type)
+		require.Equal(t, exp.State, u.State)
+		if exp.Message != "" {
+			// log updates are cli.log entries that begin with the time
+			require.True(t, strings.HasSuffix(u.Message, exp.Message), u.Message)
+		}
+		require.WithinDuration(t, time.Now(), u.Time, time.Second)
+	}
+	// the stream is finished when the simulator is closed
+	sim.Close()
+	_, err = io.ReadAll(client)
+	require.NoError(t, err)
+	// subscription to closed simulator returns closed channel
+	updates, _ := sim.Subscribe()
+	_, ok := <-updates
+	require.False(t, ok)
+}
+
+// try to run the chaos simulation with the seed
+func TestHandleConnectionChaos(t *testing.T) {
+	simLog := &lockedBuffer{}
+	cliLog := &lockedBuffer{}
+	sim := NewSimulator(cliLog, Options{Scale: 1, Clock: &instantClock{}, Log: log.New(simLog, "", 0)})
+	require.Equal(t, "\x00", sendCommand(t, sim, "chaos --seed 7"))
+	require.True(t, sim.WaitFinished(time.Second))
+	require.Contains(t, simLog.String(), "Chaos simulation seed: 7\n")
+	require.Contains(t, simLog.String(), "Chaos simulation started (seed 7)\nChaos simulation 2: ")
+	require.Contains(t, simLog.String(), "Chaos simulation finished\n")
+	require.Contains(t, cliLog.String(), "0001-01-01 00:00:00.000 INFO  Synchronization core status: ")
+	require.Equal(t, "Error: incorrect seed value 'x'", sendCommand(t, sim, "chaos --seed x"))
+	require.Equal(t, "Error: unexpected chaos argument 'now'", sendCommand(t, sim, "chaos now"))
+}
+
+// try to run the Markov scenario simulation with limited steps
+func TestHandleConnectionMarkov(t *testing.T) {
+	simLog := &lockedBuffer{}
+	cliLog := &lockedBuffer{}
+	sim := NewSimulator(cliLog, Options{Scale: 1, Clock: &instantClock{}, Log: log.New(simLog, "", 0)})
+	require.Equal(t, "\x00", sendCommand(t, sim, "markov --seed 7 --steps=50"))
+	require.True(t, sim.WaitFinished(time.Second))
+	require.Contains(t, simLog.String(), "Markov simulation seed: 7\n")
+	require.Contains(t, simLog.String(), "Markov simulation: busy\n")
+	require.Contains(t, simLog.String(), "Markov simulation finished\n")
+	require.Contains(t, cliLog.String(), " INFO  Uploaded file: 'NewFile'\n")
+	require.Equal(t, "Error: incorrect steps value '-1'", sendCommand(t, sim, "markov --steps -1"))
+	require.Equal(t, "Error: unexpected markov argument '--fast'", sendCommand(t, sim, "markov --fast"))
+	require.Contains(t, sendCommand(t, sim, "markov /not/existing.json"), "Error: scenario reading error: ")
+}
+
+// try to replay the recorded scenario
+func TestHandleConnectionReplay(t *testing.T) {
+	cliLog := &lockedBuffer{}
+	sim := NewSimulator(cliLog, Options{Scale: 1, Clock: &instantClock{}})
+	// the long path isn't cut
+	dir := filepath.Join(t.TempDir(), strings.Repeat("d", 200), strings.Repeat("d", 200))
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	file := filepath.Join(dir, "recording.json")
+	rec := &Recording{Events: []RecordedEvent{
+		{Message: "Synchronization core status: busy\n", Duration: time.Second},
+		{Log: "recorded line", Duration: time.Second},
+	}}
+	require.NoError(t, rec.Save(file))
+	require.Equal(t, "\x00", sendCommand(t, sim, "replay "+file))
+	require.True(t, sim.WaitFinished(time.Second))
+	require.Equal(t, "recorded line\n", cliLog.String())
+	require.Equal(t, "Error: recording file hasn't been specified", sendCommand(t, sim, "replay"))
+	require.Contains(t, sendCommand(t, sim, "replay "+file+".none"), "Error: recording reading error: ")
+}
+
+// try to set the progress and toggle the network loss by commands
+func TestHandleConnectionManual(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 0.01, Log: log.New(io.Discard, "", 0)})
+	require.Equal(t, "\x00", sendCommand(t, sim, "progress 30"))
+	require.True(t, sim.WaitState("busy", time.Second))
+	require.Equal(t, "Error: progress percent hasn't been specified", sendCommand(t, sim, "progress"))
+	require.Equal(t, "Error: incorrect progress value 'half': 0..100 expected", sendCommand(t, sim, "progress half"))
+	require.Equal(t, "Error: incorrect progress value '-5': 0..100 expected", sendCommand(t, sim, "progress -5"))
+	require.Equal(t, "\x00", sendCommand(t, sim, "network"))
+	require.True(t, sim.WaitState("no internet access", time.Second))
+	require.Equal(t, "\x00", sendCommand(t, sim, "network"))
+	require.True(t, sim.WaitFinished(time.Second))
+}
+
+// try to get the history and the commands statistics of daemon
+func TestHandleConnectionHistory(t *testing.T) {
+	clock := &instantClock{now: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	sim := NewSimulator(io.Discard, Options{Scale: 1, Clock: clock, Log: log.New(io.Discard, "", 0)})
+	require.Equal(t, "\x00", sendCommand(t, sim, "history"))
+	require.Equal(t, "\x00", sendCommand(t, sim, "error"))
+	require.True(t, sim.WaitFinished(time.Second))
+	sendCommand(t, sim, "status")
+	require.Equal(t, strings.Join([]string{
+		"2020-01-02 03:04:05.000 command error",
+		"2020-01-02 03:04:05.000 status  error",
+		"2020-01-02 03:04:05.000 log     2020-01-02 03:04:05.000 INFO  Synchronization core status: error",
+		"2020-01-02 03:04:05.000 log     2020-01-02 03:04:05.000 ERROR access error: 'downloads/test1'",
+		"2020-01-02 03:04:05.500 status  idle",
+		"2020-01-02 03:04:05.500 log     2020-01-02 03:04:05.500 INFO  Synchronization core status: idle",
+	}, "\n"), sendCommand(t, sim, "history"))
+	lines := strings.Split(sendCommand(t, sim, "history --jsonl"), "\n")
+	require.Len(t, lines, 6)
+	var u Update
+	require.NoError(t, json.Unmarshal([]byte(lines[4]), &u))
+	require.Equal(t, Update{Time: clock.Now(), Type: "status", State: "idle", Message: msgIdle}, u)
+	require.Equal(t, "Error: unexpected history argument '--json'", sendCommand(t, sim, "history --json"))
+	require.Equal(t, strings.Join([]string{
+		"error    1 requests, max 1 per second, interval min 0s, mean 0s, max 0s",
+		"history  4 requests, max 4 per second, interval min 0s, mean 167ms, max 500ms",
+		"stats    1 requests, max 1 per second, interval min 0s, mean 0s, max 0s",
+		"status   1 requests, max 1 per second, interval min 0s, mean 0s, max 0s",
+	}, "\n"), sendCommand(t, sim, "stats"))
+	var stats map[string]CommandStats
+	require.NoError(t, json.Unmarshal([]byte(sendCommand(t, sim, "stats --json")), &stats))
+	require.Equal(t, 2, stats["stats"].Count)
+	require.Equal(t, "Error: unexpected stats argument 'now'", sendCommand(t, sim, "stats now"))
+}
+
+// instantClock is the Clock that moves forward by the awaited duration without real waiting
+type instantClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *instantClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *instantClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// lockedBuffer is the buffer that can be written and read concurrently
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+// startDaemon sets up the daemon in temporary directories (the empty SyncDir and Socket
+// are set) and serves it in background. It returns the socket path and the channel that
+// receives the serving result. The daemon is stopped when it is still serving and closed
+// at the test cleanup.
+func startDaemon(t *testing.T, d *Daemon) (string, <-chan error) {
+	if d.SyncDir == "" {
+		d.SyncDir = t.TempDir()
+	}
+	if d.Socket == "" {
+		d.Socket = filepath.Join(t.TempDir(), "socket")
+	}
+	require.NoError(t, d.Listen())
+	done, served := make(chan error, 1), make(chan struct{})
+	go func() {
+		done <- d.Serve()
+		close(served)
+	}()
+	t.Cleanup(func() {
+		select {
+		case <-served:
+		default:
+			d.Stop()
+			<-served
+		}
+		d.Close()
+	})
+	return d.Socket, done
+}
+
+// try to run and stop the daemon with injected listener, logs and clock several times
+func TestDaemonInjected(t *testing.T) {
+	for i := range 2 {
+		socket := filepath.Join(t.TempDir(), "socket")
+		ln, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+		cliLog, simLog := &lockedBuffer{}, &lockedBuffer{}
+		clock := &instantClock{now: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+		d := &Daemon{
+			SyncDir:  t.TempDir(),
+			Listener: ln,
+			CliLog:   cliLog,
+			Options:  Options{Scale: 1, Clock: clock, Log: log.New(simLog, "", 0)},
+		}
+		require.NoError(t, d.Listen())
+		done := make(chan error, 1)
+		go func() { done <- d.Serve() }()
+
+		reply, err := Command(socket, "wait", "finished", "--timeout", "1s")
+		require.NoError(t, err)
+		require.Contains(t, reply, "Synchronization core status: idle\n")
+		require.Contains(t, simLog.String(), "Start simulation finished\n")
+		require.Contains(t, cliLog.String(), "2020-01-02 03:04:09.350 INFO  Synchronization core status: idle\n")
+		if i == 0 {
+			_, err = Command(socket, "stop")
+			require.ErrorIs(t, err, ErrStopped)
+		} else {
+			d.Stop()
+		}
+		require.NoError(t, <-done)
+		d.Close()
+		require.Contains(t, simLog.String(), "Daemon stopped\n")
+		// the stop writes only the shutdown entry into cli.log
+		require.Eventually(t, func() bool { return strings.Contains(simLog.String(), "Stop simulation finished\n") }, time.Second, 10*time.Millisecond)
+		require.True(t, strings.HasSuffix(cliLog.String(), " INFO  Daemon stopped\n"), cliLog.String())
+		require.Equal(t, 1, strings.Count(cliLog.String(), "Synchronization core status: idle\n"), cliLog.String())
+		require.Contains(t, simLog.String(), "Commands statistics:\n")
+		require.Contains(t, simLog.String(), "\nwait     1 requests, max 1 per second, ")
+		require.True(t, clock.Now().After(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+		_, err = Command(socket, "status")
+		require.Error(t, err)
+	}
+}
+
+// try to inject the latency, hang, drop and partial reply faults
+func TestDaemonFaults(t *testing.T) {
+	d := &Daemon{Options: Options{Scale: 0.01, Log: log.New(io.Discard, "", 0)}}
+	socket, done := startDaemon(t, d)
+	_, err := Command(socket, "wait", "finished")
+	require.NoError(t, err)
+	full, err := Command(socket, "status")
+	require.NoError(t, err)
+	_, err = Command(socket, "replay", strings.Repeat("/long/path", maxCommand/10))
+	require.EqualError(t, err, "Error: command is longer than 8192 bytes")
+	_, err = Command(socket, "fault", "staus", "--drop")
+	require.EqualError(t, err, "Error: unknown command 'staus'")
+	_, err = Command(socket, "fault", "fault", "off")
+	require.EqualError(t, err, "Error: unknown command 'fault'")
+
+	_, err = Command(socket, "fault", "status", "--latency", "100ms")
+	require.NoError(t, err)
+	start := time.Now()
+	reply, err := Command(socket, "status")
+	require.NoError(t, err)
+	require.Equal(t, full, reply)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	_, err = Command(socket, "fault", "status", "--partial=10")
+	require.NoError(t, err)
+	reply, err = Command(socket, "status")
+	require.NoError(t, err)
+	require.Equal(t, full[:10], reply)
+
+	_, err = Command(socket, "fault", "sync", "--drop")
+	require.NoError(t, err)
+	_, err = Command(socket, "sync")
+	require.ErrorIs(t, err, ErrStopped)
+	require.Equal(t, "idle", d.sim.State())
+
+	_, err = Command(socket, "fault", "wait", "--hang", "--latency", "1s")
+	require.NoError(t, err)
+	reply, err = Command(socket, "fault")
+	require.NoError(t, err)
+	require.Equal(t, "status: partial 10 bytes\nsync: drop\nwait: latency 1s, hang", reply)
+	conn, err := Dial(socket, "wait", "idle")
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(1500 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	_, err = Command(socket, "fault", "status", "off")
+	require.NoError(t, err)
+	reply, err = Command(socket, "status")
+	require.NoError(t, err)
+	require.Equal(t, full, reply)
+	// the handler of partially replied watch is finished at once
+	_, err = Command(socket, "fault", "watch", "--partial=5")
+	require.NoError(t, err)
+	reply, err = Command(socket, "watch")
+	require.NoError(t, err)
+	require.Equal(t, `{"tim`, reply)
+	require.Eventually(t, func() bool {
+		d.sim.subLock.Lock()
+		defer d.sim.subLock.Unlock()
+		return len(d.sim.subs) == 0
+	}, time.Second, 10*time.Millisecond)
+	_, err = Command(socket, "fault", "status", "--partial", "0")
+	require.EqualError(t, err, "Error: incorrect partial value '0'")
+	_, err = Command(socket, "fault", "status")
+	require.EqualError(t, err, "Error: fault hasn't been specified")
+
+	// the hanging connection is closed when the daemon stops
+	d.Stop()
+	require.NoError(t, <-done)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+	conn.Close()
+}
+
+// try to crash the daemon with and without the socket file left
+func TestDaemonCrash(t *testing.T) {
+	for _, tc := range []struct {
+		args  []string
+		crash Crash
+	}{
+		{nil, Crash{}},
+		{[]string{"--keep-socket", "--truncate", "--signal", "sigkill"}, Crash{KeepSocket: true, Truncate: true, Signal: syscall.SIGKILL}},
+	} {
+		cliLog, simLog := &lockedBuffer{}, &lockedBuffer{}
+		var crashed []Crash
+		d := &Daemon{
+			CliLog:  cliLog,
+			Options: Options{Scale: 0.01, Log: log.New(simLog, "", 0)},
+			Exit:    func(c Crash) { crashed = append(crashed, c) },
+		}
+		socket, done := startDaemon(t, d)
+		_, err := Command(socket, "wait", "busy")
+		require.NoError(t, err)
+		_, err = Command(socket, "crash", "--signal", "SEGV")
+		require.EqualError(t, err, "Error: unknown signal 'SEGV': KILL, TERM, INT or HUP expected")
+		_, err = Command(socket, "crash", tc.args...)
+		require.ErrorIs(t, err, ErrStopped)
+		require.ErrorIs(t, <-done, ErrCrashed)
+		d.Close()
+		require.Equal(t, []Crash{tc.crash}, crashed)
+		require.Contains(t, simLog.String(), "Daemon crashed: "+tc.crash.String()+"\n")
+		require.NotContains(t, cliLog.String(), "Synchronization core status: idle")
+		require.Equal(t, tc.crash.Truncate, !strings.HasSuffix(cliLog.String(), "\n"))
+		require.Equal(t, tc.crash.KeepSocket, !notExists(socket))
+		_, err = Command(socket, "status")
+		require.Error(t, err)
+	}
+}
+
+// try to reject the token and to recover from the token expiry by the token command
+func TestDaemonToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "passwd")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token"), 0600))
+	d := &Daemon{
+		TokenFile:   tokenFile,
+		Token:       "valid",
+		TokenExpiry: 20 * time.Second,
+		Options:     Options{Scale: 0.01, Log: log.New(io.Discard, "", 0)},
+	}
+	require.ErrorIs(t, d.CheckToken(), ErrTokenRejected)
+	require.NoError(t, os.WriteFile(tokenFile, []byte("valid\n"), 0600))
+	require.NoError(t, d.CheckToken())
+	socket, done := startDaemon(t, d)
+
+	reply, err := Command(socket, "wait", "error")
+	require.NoError(t, err)
+	require.Contains(t, reply, "\nError: authorization error\n")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("expired"), 0600))
+	_, err = Command(socket, "token")
+	require.EqualError(t, err, "Error: OAuth token has been rejected")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("valid"), 0600))
+	_, err = Command(socket, "token")
+	require.NoError(t, err)
+	_, err = Command(socket, "wait", "idle")
+	require.NoError(t, err)
+	// the token expires again after its lifetime
+	_, err = Command(socket, "wait", "error")
+	require.NoError(t, err)
+	d.Stop()
+	require.NoError(t, <-done)
+}
+
+// try to stop the daemon before its serving and during the serving start
+func TestDaemonStopBeforeServe(t *testing.T) {
+	d := &Daemon{
+		SyncDir: t.TempDir(),
+		Socket:  filepath.Join(t.TempDir(), "socket"),
+		Options: Options{Scale: 0.01, Log: log.New(io.Discard, "", 0)},
+	}
+	require.NoError(t, d.Listen())
+	defer d.Close()
+	d.Stop()
+	require.NoError(t, d.Serve())
+	d = &Daemon{Options: Options{Scale: 0.01, Log: log.New(io.Discard, "", 0)}}
+	_, done := startDaemon(t, d)
+	d.Stop()
+	require.NoError(t, <-done)
+}
+
+// try to control the daemon via HTTP control API
+func TestDaemonHTTP(t *testing.T) {
+	d := &Daemon{
+		HTTP:    "127.0.0.1:0",
+		Options: Options{Scale: 0.01, Log: log.New(io.Discard, "", 0)},
+	}
+	socket, done := startDaemon(t, d)
+	url := "http://" + d.httpLn.Addr().String()
+	call := func(method, path, body string, code int) Status {
+		req, err := http.NewRequest(method, url+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, code, resp.StatusCode, string(data))
+		var st Status
+		require.NoError(t, json.Unmarshal(data, &st))
+		return st
+	}
+	_, err := Command(socket, "wait", "finished")
+	require.NoError(t, err)
+	st := call("GET", "/status", "", http.StatusOK)
+	require.Equal(t, "idle", st.State)
+	require.Equal(t, "43.50 GB", st.Quota.Total)
+	st = call("PUT", "/quota", `{"used": "43.40 GB", "available": "0.10 GB"}`, http.StatusOK)
+	require.Equal(t, &Quota{Total: "43.50 GB", Used: "43.40 GB", Available: "0.10 GB", MaxFileSize: "50 GB", TrashSize: "0 B"}, st.Quota)
+	require.Contains(t, st.Message, "\tAvailable: 0.10 GB\n")
+	reply, err := Command(socket, "status")
+	require.NoError(t, err)
+	require.Equal(t, st.Message, reply)
+	call("POST", "/error", `{"error": "disk is full", "path": "File.ods"}`, http.StatusOK)
+	_, err = Command(socket, "wait", "error")
+	require.NoError(t, err)
+	st = call("GET", "/status", "", http.StatusOK)
+	require.Equal(t, "disk is full", st.Error)
+	require.Equal(t, "File.ods", st.ErrorPath)
+	require.Equal(t, "0.10 GB", st.Quota.Available)
+	st = call("DELETE", "/quota", "", http.StatusOK)
+	require.Equal(t, "40.61 GB", st.Quota.Available)
+	call("POST", "/markov?steps=x", "", http.StatusBadRequest)
+	call("POST", "/replay", `{"events": []}`, http.StatusConflict)
+	call("POST", "/sync", "", http.StatusOK)
+	_, err = Command(socket, "wait", "finished")
+	require.NoError(t, err)
+	call("POST", "/progress", "", http.StatusBadRequest)
+	call("POST", "/progress?percent=x", "", http.StatusBadRequest)
+	call("POST", "/progress?percent=40", "", http.StatusOK)
+	_, err = Command(socket, "wait", "busy")
+	require.NoError(t, err)
+	st = call("GET", "/status", "", http.StatusOK)
+	require.Equal(t, "55.75 MB/ 139.38 MB (40 %)", st.Progress)
+	call("POST", "/network", "", http.StatusOK)
+	_, err = Command(socket, "wait", "no", "internet", "access")
+	require.NoError(t, err)
+	// the second toggle restores the connection and begins the synchronization
+	call("POST", "/network", "", http.StatusOK)
+	_, err = Command(socket, "wait", "finished")
+	require.NoError(t, err)
+	require.Equal(t, "idle", call("GET", "/status", "", http.StatusOK).State)
+	resp, err := http.Get(url + "/history")
+	require.NoError(t, err)
+	var history []Update
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	resp.Body.Close()
+	require.True(t, strings.HasSuffix(history[len(history)-1].Message, " INFO  Synchronization core status: idle"))
+	require.True(t, slices.ContainsFunc(history, func(u Update) bool { return u.State == "error" }))
+	require.True(t, slices.ContainsFunc(history, func(u Update) bool { return u.Type == "command" && u.Message == "HTTP POST /sync" }))
+	resp, err = http.Get(url + "/history?format=jsonl")
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "application/jsonl", resp.Header.Get("Content-Type"))
+	require.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), len(history))
+	faults := func(method, path, body string, code int) string {
+		req, err := http.NewRequest(method, url+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, code, resp.StatusCode, string(data))
+		return strings.TrimSpace(string(data))
+	}
+	require.Equal(t, `{"status":{"latency":"50ms","partial":5}}`, faults("PUT", "/faults/status", `{"latency": "50ms", "partial": 5}`, http.StatusOK))
+	require.Equal(t, `{"error":"fault hasn't been specified"}`, faults("PUT", "/faults/sync", `{}`, http.StatusBadRequest))
+	require.Equal(t, `{"error":"unknown command 'staus'"}`, faults("PUT", "/faults/staus", `{"drop": true}`, http.StatusBadRequest))
+	reply, err = Command(socket, "status")
+	require.NoError(t, err)
+	require.Equal(t, "Synch", reply)
+	require.Equal(t, `{}`, faults("DELETE", "/faults/status", "", http.StatusOK))
+	d.SetFault("sync", Fault{Drop: true})
+	require.Equal(t, `{}`, faults("DELETE", "/faults", "", http.StatusOK))
+	require.Equal(t, `{"error":"unknown signal 'USR1': KILL, TERM, INT or HUP expected"}`, faults("POST", "/crash?signal=USR1", "", http.StatusBadRequest))
+	// the form of other site can't stop the daemon
+	req, err := http.NewRequest("POST", url+"/stop", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "http://example.com")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	call("POST", "/stop", "", http.StatusOK)
+	require.NoError(t, <-done)
+	_, err = http.Get(url + "/status")
+	require.Error(t, err)
+}
+
+// try to check the origin of requests to HTTP control server
+func TestSameOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		host, origin string
+		same         bool
+	}{
+		{"127.0.0.1:8080", "", true},
+		{"127.0.0.1:8080", "http://127.0.0.1:8080", true},
+		{"localhost:8080", "http://localhost:8080", true},
+		{"[::1]:8080", "http://[::1]:8080", true},
+		{"127.0.0.1:8080", "http://example.com", false},
+		{"127.0.0.1:8080", "http://localhost:8080", false},
+		{"example.com:8080", "http://example.com:8080", false},
+		{"127.0.0.1:8080", "null", false},
+	} {
+		r := &http.Request{Host: tc.host, Header: http.Header{}}
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		require.Equal(t, tc.same, sameOrigin(r), tc)
+	}
+	ln, err := listenHTTP(":0")
+	require.NoError(t, err)
+	defer ln.Close()
+	require.True(t, ln.Addr().(*net.TCPAddr).IP.IsLoopback())
+}
+
+// try to get the dashboard page and the events stream of daemon that is stopped during streaming
+func TestDaemonDashboard(t *testing.T) {
+	d := &Daemon{
+		HTTP:    filepath.Join(t.TempDir(), "http.socket"),
+		Options: Options{Scale: 0.01, Log: log.New(io.Discard, "", 0)},
+	}
+	socket, done := startDaemon(t, d)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", d.HTTP)
+		},
+	}}
+	_, err := Command(socket, "wait", "finished")
+	require.NoError(t, err)
+	resp, err := client.Get("http://simulator/")
+	require.NoError(t, err)
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.Contains(t, string(page), `new EventSource("/events")`)
+
+	resp, err = client.Get("http://simulator/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+	next := func() (string, Update) {
+		var name string
+		var u Update
+		for scanner.Scan() {
+			if v, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				name = v
+			} else if v, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				require.NoError(t, json.Unmarshal([]byte(v), &u))
+				return name, u
+			}
+		}
+		return "", u
+	}
+	// the stream begins with the last cli.log lines of start simulation and current status
+	name, u := next()
+	require.Equal(t, "log", name)
+	require.True(t, strings.HasSuffix(u.Message, " INFO  Synchronization core status: paused"), u.Message)
+	for name == "log" {
+		name, u = next()
+	}
+	require.Equal(t, "status", name)
+	require.Equal(t, "idle", u.State)
+	_, err = Command(socket, "error")
+	require.NoError(t, err)
+	name, u = next()
+	require.Equal(t, "command", name)
+	require.Equal(t, "error", u.Message)
+	name, u = next()
+	require.Equal(t, "status", name)
+	require.Equal(t, "error", u.State)
+	// the stream is finished when the daemon stops
+	d.Stop()
+	require.NoError(t, <-done)
+	for name != "" {
+		name, _ = next()
+	}
+}
@@ -0,0 +1,266 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault - the injected misbehaviour of daemon replies on the command. The latency is
+// measured by system time as it tests the client timeouts.
+type Fault struct {
+	Latency time.Duration // delay before the command handling
+	Hang    bool          // never reply: the connection is kept until the client closes it or the daemon stops
+	Drop    bool          // close the connection without reply (after the latency)
+	Partial int           // reply only the first bytes and close the connection (0 - full reply)
+}
+
+// faultJSON is the JSON form of Fault
+type faultJSON struct {
+	Latency string `json:"latency,omitempty"`
+	Hang    bool   `json:"hang,omitempty"`
+	Drop    bool   `json:"drop,omitempty"`
+	Partial int    `json:"partial,omitempty"`
+}
+
+// MarshalJSON writes the fault with latency as string
+func (f Fault) MarshalJSON() ([]byte, error) {
+	v := faultJSON{Hang: f.Hang, Drop: f.Drop, Partial: f.Partial}
+	if f.Latency > 0 {
+		v.Latency = f.Latency.String()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON parses the fault with latency as string
+func (f *Fault) UnmarshalJSON(data []byte) error {
+	var v faultJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = Fault{Hang: v.Hang, Drop: v.Drop, Partial: v.Partial}
+	if v.Latency != "" {
+		var err error
+		if f.Latency, err = time.ParseDuration(v.Latency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the fault values
+func (f Fault) validate() error {
+	switch {
+	case f.Latency < 0:
+		return fmt.Errorf("incorrect latency value '%v'", f.Latency)
+	case f.Partial < 0:
+		return fmt.Errorf("incorrect partial value '%d'", f.Partial)
+	case f == Fault{}:
+		return fmt.Errorf("%s", "fault hasn't been specified")
+	}
+	return nil
+}
+
+// String returns the fault description, e.g. "latency 2s, partial 10 bytes"
+func (f Fault) String() string {
+	var parts []string
+	if f.Latency > 0 {
+		parts = append(parts, "latency "+f.Latency.String())
+	}
+	if f.Hang {
+		parts = append(parts, "hang")
+	}
+	if f.Drop {
+		parts = append(parts, "drop")
+	}
+	if f.Partial > 0 {
+		parts = append(parts, fmt.Sprintf("partial %d bytes", f.Partial))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// faultCommands - the daemon commands which replies can be faulted. The fault command
+// isn't faulted to keep the faults under control.
+var faultCommands = []string{"status", "sync", "error", "chaos", "markov", "replay", "progress", "network",
+	"step", "wait", "watch", "history", "stats", "token", "crash", "stop"}
+
+// faults - the faults of daemon replies by command names
+type faults struct {
+	byCmd map[string]Fault // faults by command names
+	lock  sync.Mutex       // faults lock
+}
+
+// set sets the fault of the command or removes it when the fault is zero
+func (fs *faults) set(cmd string, f Fault) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if fs.byCmd == nil {
+		fs.byCmd = make(map[string]Fault)
+	}
+	if f == (Fault{}) {
+		delete(fs.byCmd, cmd)
+		return
+	}
+	fs.byCmd[cmd] = f
+}
+
+// clear removes all faults
+func (fs *faults) clear() {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	clear(fs.byCmd)
+}
+
+// get returns the fault of the command
+func (fs *faults) get(cmd string) (Fault, bool) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	f, ok := fs.byCmd[cmd]
+	return f, ok
+}
+
+// all returns all faults by command names
+func (fs *faults) all() map[string]Fault {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	res := make(map[string]Fault, len(fs.byCmd))
+	maps.Copy(res, fs.byCmd)
+	return res
+}
+
+// SetFault sets the fault of daemon replies on the command. The zero fault removes it.
+// Error is returned when the command is unknown or the fault is incorrect.
+func (d *Daemon) SetFault(cmd string, f Fault) error {
+	if !slices.Contains(faultCommands, cmd) {
+		return fmt.Errorf("unknown command '%s'", cmd)
+	}
+	if f != (Fault{}) {
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+	d.faults.set(cmd, f)
+	return nil
+}
+
+// Faults returns the faults of daemon replies by command names
+func (d *Daemon) Faults() map[string]Fault {
+	return d.faults.all()
+}
+
+// injectFault applies the fault of the command to the connection: it waits for the
+// latency and returns the connection that writes the partial reply. It returns nil
+// when the connection has to be closed without reply (hang or drop).
+func (d *Daemon) injectFault(cmd string, conn net.Conn) net.Conn {
+	f, ok := d.faults.get(cmd)
+	if !ok {
+		return conn
+	}
+	d.log.Printf("Fault of %s command: %v", cmd, f)
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-d.quit:
+		}
+	}
+	switch {
+	case f.Hang:
+		// wait until the client closes the connection or the daemon stops
+		gone := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, conn)
+			close(gone)
+		}()
+		select {
+		case <-gone:
+		case <-d.quit:
+		}
+		return nil
+	case f.Drop:
+		return nil
+	case f.Partial > 0:
+		return &partialConn{Conn: conn, left: f.Partial}
+	}
+	return conn
+}
+
+// partialConn is the connection that writes only the first bytes and closes the connection
+type partialConn struct {
+	net.Conn
+	left int // number of bytes left to write
+}
+
+// Write writes the part of data that fits into the rest of partial reply. The data
+// is reported as written to handle the command as usual.
+func (c *partialConn) Write(p []byte) (int, error) {
+	if c.left <= 0 {
+		return len(p), nil
+	}
+	n := min(len(p), c.left)
+	if _, err := c.Conn.Write(p[:n]); err != nil {
+		return 0, err
+	}
+	if c.left -= n; c.left == 0 {
+		c.Conn.Close()
+	}
+	return len(p), nil
+}
+
+// parseFaultArgs returns the command and its fault from the fault command arguments:
+// <command> off | <command> [--latency <duration>] [--hang] [--drop] [--partial <bytes>]
+func parseFaultArgs(args []string) (string, Fault, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", Fault{}, fmt.Errorf("%s", "command hasn't been specified")
+	}
+	cmd, args := args[0], args[1:]
+	if len(args) == 1 && args[0] == "off" {
+		return cmd, Fault{}, nil
+	}
+	var f Fault
+	for i := 0; i < len(args); i++ {
+		// the flags are checked first as optionValue takes the next argument as value
+		switch args[i] {
+		case "--hang":
+			f.Hang = true
+			continue
+		case "--drop":
+			f.Drop = true
+			continue
+		}
+		name, value, ok := optionValue(args, &i)
+		switch {
+		case ok && name == "--latency":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return "", Fault{}, fmt.Errorf("incorrect latency value '%s'", value)
+			}
+			f.Latency = d
+		case ok && name == "--partial":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return "", Fault{}, fmt.Errorf("incorrect partial value '%s'", value)
+			}
+			f.Partial = n
+		default:
+			return "", Fault{}, fmt.Errorf("unexpected fault argument '%s'", args[i])
+		}
+	}
+	if err := f.validate(); err != nil {
+		return "", Fault{}, err
+	}
+	return cmd, f, nil
+}
+
+// writeFaults writes the faults as text: one "<command>: <fault>" line per command
+func writeFaults(w io.Writer, faults map[string]Fault) {
+	for _, cmd := range slices.Sorted(maps.Keys(faults)) {
+		fmt.Fprintf(w, "%s: %v\n", cmd, faults[cmd])
+	}
+}
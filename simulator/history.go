@@ -0,0 +1,50 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// number of updates kept in history
+const historyLength = 1000
+
+// History returns the last status transitions, received commands and cli.log writes
+// (up to historyLength) in order of their appearance
+func (s *Simulator) History() []Update {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	return slices.Clone(s.history)
+}
+
+// LogCommand adds the received command into history and sends it to subscribers
+func (s *Simulator) LogCommand(cmd string) {
+	s.publish(Update{Time: s.Clock.Now(), Type: "command", Message: cmd})
+}
+
+// WriteTimeline writes the updates as timeline: one "<date> <time> <type> <text>" line
+// per update where the text of status update is the core status
+func WriteTimeline(w io.Writer, updates []Update) error {
+	for _, u := range updates {
+		text := u.Message
+		if u.Type == "status" {
+			text = u.State
+		}
+		if _, err := fmt.Fprintf(w, "%s %-7s %s\n", u.Time.Format(cliLogTime), u.Type, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSONLines writes the updates as JSON Lines: one JSON update per line
+func WriteJSONLines(w io.Writer, updates []Update) error {
+	enc := json.NewEncoder(w)
+	for _, u := range updates {
+		if err := enc.Encode(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
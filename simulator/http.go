@@ -0,0 +1,341 @@
+package simulator
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// number of last cli.log lines sent to the new events stream
+const eventsLogTail = 50
+
+// dashboard is the web page of HTTP control server
+//
+//go:embed dashboard.html
+var dashboard []byte
+
+// listenHTTP opens the listener of HTTP control server: the unix socket when the address
+// is a path (it begins with "/" or ".") and TCP listener of "host:port" other ways. The
+// address without host (":port") is the loopback one as the control API has no authorization.
+func listenHTTP(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, ".") {
+		return net.Listen("unix", addr)
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return net.Listen("tcp", addr)
+}
+
+// errCrossOrigin is replied on the request that changes the daemon state from other site
+var errCrossOrigin = errors.New("cross-origin request is forbidden")
+
+// sameOrigin checks that the request comes from non-browser client (without Origin header)
+// or from the page served by the control server itself, e.g. the dashboard. The host has
+// to be "localhost" or IP address as other names can be rebound by DNS to the server address.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return false
+	}
+	host := u.Hostname()
+	return host == "localhost" || net.ParseIP(host) != nil
+}
+
+// httpHandler returns the handler of HTTP control API. The API replies are JSON documents,
+// the errors are replied as {"error": "<text>"} with 4xx status code. The requests that
+// change the daemon state from other sites (see sameOrigin) are forbidden.
+//
+//	GET    /         web dashboard
+//	GET    /events   server-sent events stream of status and cli.log updates
+//	GET    /status   typed current status
+//	GET    /history  last status transitions, received commands and cli.log writes,
+//	                 query: [format=jsonl] (JSON Lines instead of JSON array)
+//	GET    /stats    statistics of commands received via daemon socket
+//	GET    /faults   faults of daemon socket replies by command names
+//	PUT    /faults/{command}
+//	                 set the fault of replies on the command by the JSON Fault in request body
+//	DELETE /faults/{command}
+//	                 remove the fault of replies on the command
+//	DELETE /faults   remove all faults of replies
+//	PUT    /quota    replace the quota values by the JSON Quota in request body
+//	DELETE /quota    return the original quota values
+//	POST   /sync     begin the synchronization simulation
+//	POST   /error    begin the error simulation, optional body: {"error": "<text>", "path": "<path>"}
+//	POST   /chaos    begin the chaos simulation, query: [seed=<number>]
+//	POST   /markov   begin the Markov scenario simulation, query: [seed=<number>] [steps=<number>],
+//	                 optional body: JSON scenario (the built-in soak scenario is used without it)
+//	POST   /replay   begin the simulation of JSON recording in request body
+//	POST   /progress begin the busy status with the sync progress percent, query: percent=<0..100>
+//	POST   /network  toggle the network loss simulation
+//	POST   /token    check the renewed OAuth token and recover from authorization error
+//	POST   /crash    exit abruptly without reply, query: [keep-socket] [truncate] [signal=<name>]
+//	POST   /stop     stop the daemon
+func (d *Daemon) httpHandler() http.Handler {
+	sim := d.sim
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboard)
+	})
+	mux.HandleFunc("GET /events", d.serveEvents)
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, sim.Status())
+	})
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "jsonl" {
+			w.Header().Set("Content-Type", "application/jsonl")
+			WriteJSONLines(w, sim.History())
+			return
+		}
+		writeJSON(w, http.StatusOK, sim.History())
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, sim.Stats())
+	})
+	mux.HandleFunc("GET /faults", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.Faults())
+	})
+	mux.HandleFunc("PUT /faults/{command}", func(w http.ResponseWriter, r *http.Request) {
+		var f Fault
+		err := readJSON(r, &f)
+		if err == nil {
+			err = f.validate()
+		}
+		if err == nil {
+			err = d.SetFault(r.PathValue("command"), f)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, d.Faults())
+	})
+	mux.HandleFunc("DELETE /faults/{command}", func(w http.ResponseWriter, r *http.Request) {
+		if err := d.SetFault(r.PathValue("command"), Fault{}); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, d.Faults())
+	})
+	mux.HandleFunc("DELETE /faults", func(w http.ResponseWriter, r *http.Request) {
+		d.faults.clear()
+		writeJSON(w, http.StatusOK, d.Faults())
+	})
+	mux.HandleFunc("PUT /quota", func(w http.ResponseWriter, r *http.Request) {
+		q := &Quota{}
+		if err := readJSON(r, q); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sim.SetQuota(q)
+		writeJSON(w, http.StatusOK, sim.Status())
+	})
+	mux.HandleFunc("DELETE /quota", func(w http.ResponseWriter, r *http.Request) {
+		sim.SetQuota(nil)
+		writeJSON(w, http.StatusOK, sim.Status())
+	})
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, r *http.Request) {
+		d.simulated(w, sim.Simulate("Synchronization"))
+	})
+	mux.HandleFunc("POST /error", func(w http.ResponseWriter, r *http.Request) {
+		var v struct{ Error, Path string }
+		if err := readJSON(r, &v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		d.simulated(w, sim.SimulateError(context.Background(), v.Error, v.Path))
+	})
+	mux.HandleFunc("POST /chaos", func(w http.ResponseWriter, r *http.Request) {
+		seed, err := parseChaosArgs(queryArgs(r, "seed"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		d.simulated(w, sim.SimulateChaos(context.Background(), seed))
+	})
+	mux.HandleFunc("POST /markov", func(w http.ResponseWriter, r *http.Request) {
+		m, seed, err := parseMarkovArgs(queryArgs(r, "seed", "steps"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		loaded := &Markov{}
+		switch err = readJSON(r, loaded); {
+		case err != nil:
+			writeError(w, http.StatusBadRequest, fmt.Errorf("scenario parsing error: %w", err))
+			return
+		case loaded.States != nil:
+			if r.URL.Query().Has("steps") {
+				loaded.Steps = m.Steps
+			}
+			m = loaded
+		}
+		d.simulated(w, sim.SimulateMarkov(context.Background(), m, seed))
+	})
+	mux.HandleFunc("POST /replay", func(w http.ResponseWriter, r *http.Request) {
+		rec := &Recording{}
+		if err := readJSON(r, rec); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("recording parsing error: %w", err))
+			return
+		}
+		d.simulated(w, sim.SimulateReplay(context.Background(), rec))
+	})
+	mux.HandleFunc("POST /progress", func(w http.ResponseWriter, r *http.Request) {
+		var args []string
+		if q := r.URL.Query(); q.Has("percent") {
+			args = []string{q.Get("percent")}
+		}
+		percent, err := parseProgressArgs(args)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		d.simulated(w, sim.SimulateProgress(context.Background(), percent))
+	})
+	mux.HandleFunc("POST /network", func(w http.ResponseWriter, r *http.Request) {
+		_, err := sim.ToggleNetwork(context.Background())
+		d.simulated(w, err)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		err := d.CheckToken()
+		if err == nil {
+			err = d.renewToken()
+		}
+		d.simulated(w, err)
+	})
+	mux.HandleFunc("POST /crash", func(w http.ResponseWriter, r *http.Request) {
+		args := queryArgs(r, "signal")
+		for _, flag := range []string{"keep-socket", "truncate"} {
+			if r.URL.Query().Has(flag) {
+				args = append(args, "--"+flag)
+			}
+		}
+		c, err := parseCrashArgs(args)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// the connection is closed without reply like the process exit does
+		if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+			conn.Close()
+		}
+		d.crash(c)
+	})
+	mux.HandleFunc("POST /stop", func(w http.ResponseWriter, r *http.Request) {
+		d.stop()
+		writeJSON(w, http.StatusOK, sim.Status())
+		d.finish(nil)
+	})
+	// the requests that change the daemon state are kept in history as commands
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			if !sameOrigin(r) {
+				writeError(w, http.StatusForbidden, errCrossOrigin)
+				return
+			}
+			sim.LogCommand("HTTP " + r.Method + " " + r.URL.RequestURI())
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// serveEvents streams the updates as server-sent events: the event name is the update
+// type and the data is the JSON update. The stream begins with the last cli.log lines and
+// the current status. It is finished when the client disconnects or the server stops.
+func (d *Daemon) serveEvents(w http.ResponseWriter, r *http.Request) {
+	sim := d.sim
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	updates, cancel := sim.Subscribe()
+	defer cancel()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(u Update) error {
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", u.Type, data)
+		return err
+	}
+	var logs []Update
+	for _, u := range sim.History() {
+		if u.Type == "log" {
+			logs = append(logs, u)
+		}
+	}
+	initial := append(logs[max(0, len(logs)-eventsLogTail):], Update{Time: sim.Clock.Now(), Type: "status", State: sim.State(), Message: sim.GetMessage()})
+	for _, u := range initial {
+		if send(u) != nil {
+			return // client has gone
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok || send(u) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// simulated replies by the current status when the simulation is started or by the error
+func (d *Daemon) simulated(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d.sim.Status())
+}
+
+// queryArgs returns the query parameters with names as command arguments: --name=value
+func queryArgs(r *http.Request, names ...string) []string {
+	var args []string
+	q := r.URL.Query()
+	for _, n := range names {
+		if q.Has(n) {
+			args = append(args, "--"+n+"="+q.Get(n))
+		}
+	}
+	return args
+}
+
+// readJSON decodes the JSON request body into v. The empty body leaves v unchanged.
+func readJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// writeJSON writes the reply with status code and v as JSON document
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error reply: {"error": "<text>"}
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
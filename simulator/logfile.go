@@ -0,0 +1,76 @@
+package simulator
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sync"
+)
+
+// logFile is the daemon's synchronization log (cli.log) writer. It reopens the
+// file when it was deleted or rotated (renamed) by somebody else.
+type logFile struct {
+	path string      // log file path
+	file *os.File    // opened log file
+	lock sync.Mutex  // writing lock
+	log  *log.Logger // simulator log
+}
+
+// openLogFile creates the log file directory if it is not exists and opens the log file
+func openLogFile(filePath string, logger *log.Logger) (*logFile, error) {
+	l := &logFile{path: filePath, log: logger}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open creates the log file directory if it is not exists and opens the log file for appending
+func (l *logFile) open() error {
+	dir := path.Dir(l.path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("%s creation error: %w", dir, err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("%s opening error: %w", l.path, err)
+	}
+	l.file = f
+	return nil
+}
+
+// moved returns true when the opened file is not the file on the log file path any more
+func (l *logFile) moved() bool {
+	pathInfo, err := os.Stat(l.path)
+	if err != nil {
+		return true
+	}
+	fileInfo, err := l.file.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(pathInfo, fileInfo)
+}
+
+// Write writes the data into log file. It reopens the log file before writing
+// when the file was deleted or rotated.
+func (l *logFile) Write(data []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.moved() {
+		handleErr(l.log, "%s was deleted or rotated, reopening it", l.path)
+		l.file.Close()
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	}
+	return l.file.Write(data)
+}
+
+// Close closes the log file
+func (l *logFile) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
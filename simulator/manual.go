@@ -0,0 +1,124 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// ProgressSet is the name of the set progress simulation set
+	ProgressSet = "Progress"
+	// NetworkSet is the name of network loss simulation set
+	NetworkSet = "Network"
+	// AuthSet is the name of authorization error simulation set
+	AuthSet = "Auth"
+	// total size of synchronized files in progress simulation, MB
+	progressTotal = 139.38
+	// duration of the set progress
+	progressTime = 5 * time.Second
+	// core status of network loss
+	offlineState = "no internet access"
+	// interval of connection checks during network loss
+	offlineCheck = 10 * time.Second
+	// error of expired token
+	authError = "authorization error"
+)
+
+// SimulateProgress starts the simulation of busy status with the sync progress percent.
+// The status becomes idle after a while when no other progress is set.
+func (s *Simulator) SimulateProgress(ctx context.Context, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("incorrect progress value '%d': 0..100 expected", percent)
+	}
+	done := math.Round(progressTotal*float64(percent)) / 100
+	e := event{
+		msg: fmt.Sprintf("Sync progress: %s MB/ %s MB (%d %%)\n%sbusy\n%s",
+			strconv.FormatFloat(done, 'f', -1, 64), strconv.FormatFloat(progressTotal, 'f', -1, 64), percent, statePrefix, msgTail()),
+		duration: progressTime,
+		logMsg:   fmt.Sprintf("Progress simulation: %d %%", percent),
+	}
+	return s.run(ctx, ProgressSet, s.policy(ProgressSet), slices.Values([]event{e}))
+}
+
+// ToggleNetwork switches the network loss simulation. The network loss lasts until the
+// next call that begins the synchronization simulation as the daemon does after the
+// connection is restored. It returns true when the network loss simulation is started.
+func (s *Simulator) ToggleNetwork(ctx context.Context) (bool, error) {
+	s.runLock.Lock()
+	cancel := s.offline
+	s.offline = nil
+	s.runLock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if s.State() == offlineState {
+		return false, s.SimulateContext(ctx, "Synchronization")
+	}
+	ctx, cancel = context.WithCancel(ctx)
+	e := event{
+		msg:      statePrefix + offlineState + "\n" + msgTail(),
+		duration: offlineCheck,
+		logMsg:   "Network simulation: connection lost",
+	}
+	if err := s.run(ctx, NetworkSet, s.policy(NetworkSet), lastingEvents(e)); err != nil {
+		cancel()
+		return false, err
+	}
+	s.runLock.Lock()
+	s.offline = cancel
+	s.runLock.Unlock()
+	return true, nil
+}
+
+// ExpireToken starts the authorization error simulation. The error lasts until the
+// RestoreToken call as the daemon can't synchronize without valid token.
+func (s *Simulator) ExpireToken(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	e := event{
+		msg:      statePrefix + "error\nError: " + authError + "\n" + msgTail(),
+		duration: offlineCheck,
+		logMsg:   "Token simulation: token expired",
+	}
+	if err := s.run(ctx, AuthSet, s.policy(AuthSet), lastingEvents(e)); err != nil {
+		cancel()
+		return err
+	}
+	s.runLock.Lock()
+	prev := s.expired
+	s.expired = cancel
+	s.runLock.Unlock()
+	if prev != nil {
+		prev()
+	}
+	return nil
+}
+
+// RestoreToken finishes the authorization error simulation and begins the synchronization
+// simulation as the daemon does after the token renewal. It does nothing when the token
+// hasn't expired.
+func (s *Simulator) RestoreToken(ctx context.Context) error {
+	s.runLock.Lock()
+	cancel := s.expired
+	s.expired = nil
+	s.runLock.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	return s.SimulateContext(ctx, "Synchronization")
+}
+
+// lastingEvents returns the endless sequence of events: the status is changed by the
+// first event and the next ones only last its duration (e.g. the connection checks)
+func lastingEvents(e event) iter.Seq[event] {
+	return func(yield func(event) bool) {
+		for yield(e) {
+			e = event{duration: e.duration}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"math/rand"
+	"os"
+	"slices"
+	"time"
+)
+
+// MarkovSet is the name of Markov scenario simulation set
+const MarkovSet = "Markov"
+
+// Markov - the scenario described as a state machine: the simulation begins in the
+// Start state, stays in each state for the random dwell time and moves to the next
+// state chosen randomly according to the transition weights.
+type Markov struct {
+	Start  string                 `json:"start"`  // initial state
+	Steps  int                    `json:"steps"`  // number of states to go through, 0 means until cancellation
+	States map[string]MarkovState `json:"states"` // scenario states by their names
+}
+
+// MarkovState - the state of Markov scenario
+type MarkovState struct {
+	Status  string             `json:"status"`  // core status, the state name is used when it is ""
+	Message string             `json:"message"` // full status message that overrides the generated one
+	Log     string             `json:"log"`     // additional cli.log entry "<LEVEL> <text>" on entering, e.g. "WARN Disk is almost full"
+	Dwell   Dwell              `json:"dwell"`   // dwell time distribution
+	Next    map[string]float64 `json:"next"`    // transition weights by the next state names
+}
+
+// Dwell - the distribution of state dwell time. The time is uniformly distributed
+// between Min and Max when Mean is zero. Otherwise it is Min plus exponentially
+// distributed time with Mean, limited by Max when Max isn't zero.
+// In JSON the durations are strings like "1.5s".
+type Dwell struct {
+	Min  time.Duration
+	Max  time.Duration
+	Mean time.Duration
+}
+
+// UnmarshalJSON parses the dwell time distribution with durations as strings
+func (d *Dwell) UnmarshalJSON(data []byte) error {
+	var v struct{ Min, Max, Mean string }
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		value string
+		dst   *time.Duration
+	}{{v.Min, &d.Min}, {v.Max, &d.Max}, {v.Mean, &d.Mean}} {
+		if f.value == "" {
+			continue
+		}
+		var err error
+		if *f.dst, err = time.ParseDuration(f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sample returns the random dwell time
+func (d Dwell) sample(r *rand.Rand) time.Duration {
+	if d.Mean > 0 {
+		t := d.Min + time.Duration(r.ExpFloat64()*float64(d.Mean))
+		if d.Max > 0 && t > d.Max {
+			t = d.Max
+		}
+		return t
+	}
+	if d.Max > d.Min {
+		return d.Min + time.Duration(r.Int63n(int64(d.Max-d.Min)))
+	}
+	return d.Min
+}
+
+// SoakScenario is the built-in Markov scenario of long-running daemon: it is mostly
+// idle, occasionally synchronizes files and rarely reports errors.
+var SoakScenario = &Markov{
+	Start: "idle",
+	States: map[string]MarkovState{
+		"idle": {
+			Dwell: Dwell{Min: 5 * time.Second, Max: 10 * time.Minute, Mean: 30 * time.Second},
+			Next:  map[string]float64{"index": 95, "error": 5},
+		},
+		"index": {
+			Message: simSet["Synchronization"][0].msg,
+			Dwell:   Dwell{Min: 500 * time.Millisecond, Max: 2 * time.Second},
+			Next:    map[string]float64{"busy": 80, "idle": 20},
+		},
+		"busy": {
+			Message: simSet["Synchronization"][2].msg,
+			Dwell:   Dwell{Min: time.Second, Max: 10 * time.Second},
+			Next:    map[string]float64{"synchronized": 98, "error": 2},
+		},
+		"synchronized": {
+			Message: simSet["Synchronization"][3].msg,
+			Dwell:   Dwell{Min: 500 * time.Millisecond, Max: time.Second},
+			Next:    map[string]float64{"idle": 1},
+		},
+		"error": {
+			Message: simSet["Error"][0].msg,
+			Dwell:   Dwell{Min: time.Second, Max: 5 * time.Second},
+			Next:    map[string]float64{"idle": 1},
+		},
+	},
+}
+
+// LoadMarkov reads the Markov scenario from JSON file and validates it
+func LoadMarkov(filePath string) (*Markov, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("scenario reading error: %w", err)
+	}
+	m := &Markov{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("scenario parsing error: %w", err)
+	}
+	if err = m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate checks that the scenario begins in existing state and that each state has
+// correct dwell time and at least one transition to existing state with positive weight.
+// The endless scenario must have a state with positive dwell time as it never ends otherwise.
+func (m *Markov) Validate() error {
+	if _, ok := m.States[m.Start]; !ok {
+		return fmt.Errorf("incorrect scenario: unknown start state '%s'", m.Start)
+	}
+	if m.Steps < 0 {
+		return errors.New("incorrect scenario: negative number of steps")
+	}
+	dwells := false
+	for name, st := range m.States {
+		dwells = dwells || st.Dwell.Min > 0 || st.Dwell.Mean > 0 || st.Dwell.Max > 0
+		if st.Dwell.Min < 0 || st.Dwell.Mean < 0 || st.Dwell.Max != 0 && st.Dwell.Max < st.Dwell.Min {
+			return fmt.Errorf("incorrect scenario: wrong dwell time of state '%s'", name)
+		}
+		if len(st.Next) == 0 {
+			return fmt.Errorf("incorrect scenario: state '%s' has no transitions", name)
+		}
+		for next, w := range st.Next {
+			if _, ok := m.States[next]; !ok {
+				return fmt.Errorf("incorrect scenario: unknown state '%s' in transitions of '%s'", next, name)
+			}
+			if w <= 0 {
+				return fmt.Errorf("incorrect scenario: not positive weight of transition '%s' -> '%s'", name, next)
+			}
+		}
+	}
+	if m.Steps == 0 && !dwells {
+		return errors.New("incorrect scenario: endless scenario has no state with positive dwell time")
+	}
+	return nil
+}
+
+// events returns the sequence of events of random walk through the scenario states
+// generated by the seed. The same seed always gives the same sequence.
+func (m *Markov) events(seed int64) iter.Seq[event] {
+	return func(yield func(event) bool) {
+		r := rand.New(rand.NewSource(seed))
+		name := m.Start
+		for i := 0; m.Steps == 0 || i < m.Steps; i++ {
+			st := m.States[name]
+			if !yield(event{msg: st.message(name), duration: st.Dwell.sample(r), logMsg: "Markov simulation: " + name, entry: st.Log}) {
+				return
+			}
+			name = st.next(r)
+		}
+	}
+}
+
+// message returns the status message of the state
+func (st MarkovState) message(name string) string {
+	if st.Message != "" {
+		return st.Message
+	}
+	if st.Status != "" {
+		name = st.Status
+	}
+	return statePrefix + name + "\n" + msgTail()
+}
+
+// next returns the randomly chosen next state name
+func (st MarkovState) next(r *rand.Rand) string {
+	// the names are sorted as map iteration order is random
+	names := slices.Sorted(maps.Keys(st.Next))
+	var total float64
+	for _, n := range names {
+		total += st.Next[n]
+	}
+	v := r.Float64() * total
+	for _, n := range names {
+		if v -= st.Next[n]; v < 0 {
+			return n
+		}
+	}
+	return names[len(names)-1]
+}
+
+// SimulateMarkov starts the simulation of Markov scenario with random values generated
+// by the seed. The seed is written into simulator log to make possible the exact
+// reproduction of simulation. The scenario without Steps limit runs until it is
+// cancelled by context or pre-empted by any next simulation (queued one as well).
+func (s *Simulator) SimulateMarkov(ctx context.Context, m *Markov, seed int64) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	s.Log.Printf("%s simulation seed: %d", MarkovSet, seed)
+	return s.start(ctx, MarkovSet, s.policy(MarkovSet), m.events(seed), m.Steps == 0)
+}
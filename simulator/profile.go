@@ -0,0 +1,88 @@
+package simulator
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Profile - the output profile of particular yandex-disk release. It changes the
+// status messages and the texts of original product errors. The nil Profile keeps
+// the messages and texts as they are.
+type Profile struct {
+	Name         string            // profile name: yandex-disk release, e.g. "0.1.6"
+	Version      string            // full version of release for version output
+	ProgressLast bool              // the sync progress line follows the status line
+	Texts        map[string]string // replacements of texts in messages and errors
+	replacer     *strings.Replacer // replacer of Texts
+	once         sync.Once         // replacer creation
+}
+
+// Profiles - the known output profiles by their names
+var Profiles = map[string]*Profile{
+	"0.1.6": {
+		Name:    "0.1.6",
+		Version: "0.1.6.1080",
+	},
+	"0.1.5": {
+		Name:         "0.1.5",
+		Version:      "0.1.5.1039",
+		ProgressLast: true,
+		Texts: map[string]string{
+			"The quota has not been received yet.": "Quota information is not received yet.",
+			"Last synchronized items:":             "Last synchronized files:",
+			"Indicated directory does not exist":   "indicated directory does not exist",
+			"daemon not started":                   "daemon is not running",
+		},
+	},
+}
+
+// ParseProfile returns the output profile by its name. Empty name means no profile (nil).
+func ParseProfile(name string) (*Profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile '%s': one of %s expected", name, strings.Join(slices.Sorted(maps.Keys(Profiles)), ", "))
+	}
+	return p, nil
+}
+
+// Text returns the text with profile replacements
+func (p *Profile) Text(s string) string {
+	if p == nil || len(p.Texts) == 0 {
+		return s
+	}
+	p.once.Do(func() { p.replacer = newReplacer(p.Texts) })
+	return p.replacer.Replace(s)
+}
+
+// Render returns the status message in the profile format
+func (p *Profile) Render(msg string) string {
+	if p == nil {
+		return msg
+	}
+	if p.ProgressLast && strings.HasPrefix(msg, "Sync progress: ") {
+		progress, rest, _ := strings.Cut(msg, "\n")
+		status, rest, _ := strings.Cut(rest, "\n")
+		msg = status + "\n" + progress + "\n" + rest
+	}
+	return p.Text(msg)
+}
+
+// newReplacer returns the replacer of texts keys by their values. The longer texts
+// are replaced first as they may include shorter ones.
+func newReplacer(texts map[string]string) *strings.Replacer {
+	keys := slices.SortedFunc(maps.Keys(texts), func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, texts[k])
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,221 @@
+package simulator
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ReplaySet is the name of recorded scenario simulation set
+const ReplaySet = "Replay"
+
+// Recording - the scenario recorded from the output of yandex-disk utility
+type Recording struct {
+	Events []RecordedEvent `json:"events"`
+}
+
+// RecordedEvent - the recorded status change or cli.log line. The status message
+// stays the same when the Message is "". In JSON the duration is a string like "1.5s".
+type RecordedEvent struct {
+	Message  string        // status message
+	Log      string        // cli.log line
+	Duration time.Duration // time until the next event
+}
+
+// recordedEventJSON is the JSON form of RecordedEvent
+type recordedEventJSON struct {
+	Message  string `json:"message,omitempty"`
+	Log      string `json:"log,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// MarshalJSON writes the recorded event with duration as string
+func (e RecordedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(recordedEventJSON{e.Message, e.Log, e.Duration.String()})
+}
+
+// UnmarshalJSON parses the recorded event with duration as string
+func (e *RecordedEvent) UnmarshalJSON(data []byte) error {
+	var v recordedEventJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(v.Duration)
+	if err != nil {
+		return err
+	}
+	*e = RecordedEvent{Message: v.Message, Log: v.Log, Duration: d}
+	return nil
+}
+
+// LoadRecording reads the recorded scenario from JSON file
+func LoadRecording(filePath string) (*Recording, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("recording reading error: %w", err)
+	}
+	r := &Recording{}
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("recording parsing error: %w", err)
+	}
+	return r, nil
+}
+
+// Save writes the recorded scenario into JSON file
+func (r *Recording) Save(filePath string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filePath, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("recording writing error: %w", err)
+	}
+	return nil
+}
+
+// events returns the sequence of recorded events
+func (r *Recording) events() iter.Seq[event] {
+	return func(yield func(event) bool) {
+		for _, e := range r.Events {
+			if !yield(event{msg: e.Message, duration: e.Duration, entry: e.Log}) {
+				return
+			}
+		}
+	}
+}
+
+// SimulateReplay starts the simulation of recorded scenario: the recorded status
+// messages and cli.log lines are reproduced verbatim with the recorded timing: the
+// status messages aren't rendered by the output profile.
+func (s *Simulator) SimulateReplay(ctx context.Context, r *Recording) error {
+	if len(r.Events) == 0 {
+		return errors.New("recording has no events")
+	}
+	return s.run(ctx, ReplaySet, s.policy(ReplaySet), r.events())
+}
+
+// Record polls the status of yandex-disk utility (exe) every interval and reads
+// new lines of its cli.log until the context is done (the running status command is
+// interrupted as well). It returns the recording
+// where each status change and each cli.log line is an event with timing.
+// The status output (including error messages) is recorded verbatim.
+func Record(ctx context.Context, exe, cliLog string, interval time.Duration) (*Recording, error) {
+	tail, err := newLogTail(cliLog)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{}
+	var times []time.Time
+	add := func(e RecordedEvent) {
+		rec.Events = append(rec.Events, e)
+		times = append(times, time.Now())
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// the durations are the intervals between events, the last one lasts until the end
+	result := func() *Recording {
+		end := time.Now()
+		for i := range rec.Events {
+			if i+1 < len(times) {
+				rec.Events[i].Duration = times[i+1].Sub(times[i])
+			} else {
+				rec.Events[i].Duration = end.Sub(times[i])
+			}
+		}
+		return rec
+	}
+	prev := ""
+	for {
+		out, err := exec.CommandContext(ctx, exe, "status").CombinedOutput()
+		if ctx.Err() != nil {
+			// the output of interrupted status command isn't recorded
+			return result(), nil
+		}
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("status command error: %w", err)
+		}
+		// the line end added by the utility output is removed as the status is printed
+		// with it on replay. The empty message means unchanged status in recording, so
+		// empty output is recorded as " " like the simulator shows the status of starting daemon
+		msg := cmp.Or(strings.TrimSuffix(string(out), "\n"), " ")
+		if msg != prev {
+			add(RecordedEvent{Message: msg})
+			prev = msg
+		}
+		lines, err := tail.lines()
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			add(RecordedEvent{Log: l})
+		}
+		select {
+		case <-ctx.Done():
+			return result(), nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// logTail reads the lines appended to the log file
+type logTail struct {
+	path   string // log file path
+	offset int64  // size of already read part of file
+}
+
+// newLogTail returns the tail of log file that reads only the lines appended after it's creation
+func newLogTail(filePath string) (*logTail, error) {
+	t := &logTail{path: filePath}
+	info, err := os.Stat(filePath)
+	switch {
+	case err == nil:
+		t.offset = info.Size()
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("cli.log reading error: %w", err)
+	}
+	return t, nil
+}
+
+// lines returns the complete lines appended to the log file since the last call.
+// The file is read from the beginning when it was truncated or replaced by smaller one.
+func (t *logTail) lines() ([]string, error) {
+	f, err := os.Open(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cli.log reading error: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cli.log reading error: %w", err)
+	}
+	if info.Size() < t.offset {
+		t.offset = 0
+	}
+	if _, err = f.Seek(t.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("cli.log reading error: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("cli.log reading error: %w", err)
+	}
+	// the incomplete last line is left for the next call
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	t.offset += int64(end) + 1
+	return strings.Split(string(data[:end]), "\n"), nil
+}
@@ -0,0 +1,702 @@
+// Package simulator is the engine of yandex-disk simulator: it simulates the status
+// transitions and cli.log writing of the original yandex-disk daemon and serves
+// the commands of yandex-disk utility received via unix socket.
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Idle message of working daemon
+	msgIdle = "Synchronization core status: idle\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n"
+	// Error message of cli.log writing error
+	msgLogError = "Synchronization core status: error\nError: access error\nPath: '.sync/cli.log'\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n"
+	// prefix of the status line in status message
+	statePrefix = "Synchronization core status: "
+	// stopping pause time
+	stopTime = 110 * time.Millisecond
+	// size of subscriber's updates buffer
+	updatesBuffer = 256
+)
+
+var (
+	// start, sync, and error events sequences
+	// The read-only and overwrite variants of synchronization are used instead of
+	// "Synchronization" when the daemon is started with --read-only option.
+	simSet = map[string][]event{
+		"Start": {
+			{
+				" ",
+				1200 * time.Millisecond,
+				"",
+				""},
+			{
+				"Synchronization core status: paused\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tThe quota has not been received yet.\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				250 * time.Millisecond,
+				"Start simulation 1",
+				""},
+			{
+				"Synchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tThe quota has not been received yet.\n\n",
+				600 * time.Millisecond,
+				"Start simulation 2",
+				""},
+			{
+				"Synchronization core status: busy\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tThe quota has not been received yet.\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				100 * time.Millisecond,
+				"Start simulation 3",
+				""},
+			{
+				"Synchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tThe quota has not been received yet.\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				2200 * time.Millisecond,
+				"Start simulation 4",
+				""},
+		},
+		"Synchronization": {
+			{
+				"Synchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				900 * time.Millisecond,
+				"Synchronization simulation started",
+				""},
+			{
+				"Sync progress: 0 MB/ 139.38 MB (0 %)\nSynchronization core status: busy\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				100 * time.Millisecond,
+				"Synchronization simulation 1",
+				""},
+			{
+				"Sync progress: 65.34 MB/ 139.38 MB (46 %)\nSynchronization core status: busy\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				1500 * time.Millisecond,
+				"Synchronization simulation 2",
+				""},
+			{
+				"Sync progress: 139.38 MB/ 139.38 MB (100 %)\nSynchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'NewFile'\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\n",
+				500 * time.Millisecond,
+				"Synchronization simulation 3",
+				""},
+		},
+		"Synchronization (read-only)": {
+			{
+				"Synchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				900 * time.Millisecond,
+				"Synchronization simulation started (read-only mode)",
+				""},
+			{
+				"Sync progress: 0 MB/ 74.04 MB (0 %)\nSynchronization core status: busy\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				100 * time.Millisecond,
+				"Synchronization simulation 1 (read-only mode)",
+				"WARN Local changes of 'NewFile' are not uploaded: read-only mode"},
+			{
+				"Sync progress: 74.04 MB/ 74.04 MB (100 %)\nSynchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				500 * time.Millisecond,
+				"Synchronization simulation 3 (read-only mode)",
+				""},
+		},
+		"Synchronization (overwrite)": {
+			{
+				"Synchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				900 * time.Millisecond,
+				"Synchronization simulation started (overwrite mode)",
+				""},
+			{
+				"Sync progress: 0 MB/ 74.04 MB (0 %)\nSynchronization core status: busy\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				100 * time.Millisecond,
+				"Synchronization simulation 1 (overwrite mode)",
+				"WARN Local changes of 'NewFile' are overwritten by its version from Yandex.Disk"},
+			{
+				"Sync progress: 74.04 MB/ 74.04 MB (100 %)\nSynchronization core status: index\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.89 GB\n\tAvailable: 40.61 GB\n\tMax file size: 50 GB\n\tTrash size: 0 B\n\nLast synchronized items:\n\tfile: 'NewFile'\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\n",
+				500 * time.Millisecond,
+				"Synchronization simulation 3 (overwrite mode)",
+				""},
+		},
+		"Error": {
+			{
+				"Synchronization core status: error\nError: access error\nPath: 'downloads/test1'\nPath to Yandex.Disk directory: '/home/stc/Yandex.Disk'\n\tTotal: 43.50 GB\n\tUsed: 2.88 GB\n\tAvailable: 40.62 GB\n\tMax file size: 50 GB\n\tTrash size: 654.48 MB\n\nLast synchronized items:\n\tfile: 'File.ods'\n\tfile: 'downloads/file.deb'\n\tfile: 'downloads/setup'\n\tfile: 'download'\n\tfile: 'down'\n\tfile: 'do_it'\n\tfile: 'very_very_long_long_file_with_underscore'\n\tfile: 'o'\n\tfile: 'w'\n\tfile: 'n'\n\n",
+				500 * time.Millisecond,
+				"Error simulation 1",
+				""},
+		},
+		"Stop": {
+			{
+				" ",
+				100 * time.Millisecond,
+				"",
+				"INFO Daemon stopped"},
+		},
+	}
+)
+
+// event - the structure for change event
+type event struct {
+	msg      string        // status message
+	duration time.Duration // event duration
+	logMsg   string        // message to write to simulator log or skip writing when it ""
+	entry    string        // additional cli.log entry "<LEVEL> <text>" or "" when there is nothing to add
+}
+
+// ParseTimeScale returns the time scale factor from its string representation.
+// Empty value means factor 1. Values less than 1 speed up the simulation,
+// values greater than 1 slow it down.
+func ParseTimeScale(value string) (float64, error) {
+	if value == "" {
+		return 1, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("incorrect time scale factor '%s': positive number expected", value)
+	}
+	return f, nil
+}
+
+// Scale returns the duration multiplied by the time scale factor
+func Scale(d time.Duration, factor float64) time.Duration {
+	return time.Duration(float64(d) * factor)
+}
+
+// SyncMode defines how the daemon handles the local changes
+type SyncMode int
+
+const (
+	ModeNormal    SyncMode = iota // upload local changes
+	ModeReadOnly                  // don't upload local changes (--read-only)
+	ModeOverwrite                 // overwrite local changes by Yandex.Disk versions (--read-only --overwrite)
+)
+
+// syncSets maps the synchronization mode to the synchronization events sequence
+var syncSets = map[SyncMode]string{
+	ModeNormal:    "Synchronization",
+	ModeReadOnly:  "Synchronization (read-only)",
+	ModeOverwrite: "Synchronization (overwrite)",
+}
+
+// generatedSets - the simulation sets which events are generated or loaded at start
+var generatedSets = []string{ChaosSet, MarkovSet, ReplaySet, ProgressSet, NetworkSet, AuthSet}
+
+// Policy defines how the new simulation treats running and queued simulations
+type Policy int
+
+const (
+	PolicyQueue   Policy = iota // start after the end of running and queued simulations
+	PolicyReplace               // cancel running and queued simulations and start immediately
+	PolicyReject                // refuse to start when other simulation is running or queued
+)
+
+// policyNames maps the policy names to policies
+var policyNames = map[string]Policy{
+	"queue":   PolicyQueue,
+	"replace": PolicyReplace,
+	"reject":  PolicyReject,
+}
+
+// simPolicies - the default start policies of simulation sets (queue when it is not listed).
+// The Stop set policy can't be overridden: stop always pre-empts all other simulations.
+var simPolicies = map[string]Policy{
+	"Error":     PolicyReplace,
+	"Stop":      PolicyReplace,
+	ProgressSet: PolicyReplace,
+	NetworkSet:  PolicyReplace,
+	AuthSet:     PolicyReplace,
+}
+
+// ParsePolicies returns the simulation sets policies from their string representation:
+// comma separated list of <set>=<policy> pairs, e.g. "Synchronization=reject,Error=queue".
+func ParsePolicies(value string) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+	if value == "" {
+		return policies, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		set, name, _ := strings.Cut(item, "=")
+		p, ok := policyNames[name]
+		if _, known := simSet[set]; !known && !slices.Contains(generatedSets, set) || !ok || set == "Stop" {
+			return nil, fmt.Errorf("incorrect simulation policy '%s': <set>=queue|replace|reject expected", item)
+		}
+		policies[set] = p
+	}
+	return policies, nil
+}
+
+// Clock is the source of time for the simulation
+type Clock interface {
+	Now() time.Time                         // current time
+	After(d time.Duration) <-chan time.Time // channel that receives the time after the duration
+}
+
+// realClock is the Clock of system time
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Options - the simulation options
+type Options struct {
+	Mode     SyncMode          // synchronization mode
+	Scale    float64           // time scale factor for events durations (factor 1 when it is 0)
+	Stepping bool              // make transitions only by Step calls
+	Policies map[string]Policy // start policies that override the default ones
+	Clock    Clock             // source of time for events durations (system time when it is nil)
+	Log      *log.Logger       // simulator log (standard logger when it is nil)
+	Profile  *Profile          // output profile of yandex-disk release (messages are unchanged when it is nil)
+}
+
+// withDefaults returns the options where the zero Scale and the nil Clock and Log are
+// replaced by default ones
+func (o Options) withDefaults() Options {
+	if o.Scale == 0 {
+		o.Scale = 1
+	}
+	if o.Clock == nil {
+		o.Clock = realClock{}
+	}
+	if o.Log == nil {
+		o.Log = log.Default()
+	}
+	return o
+}
+
+// handleErr formats error, writes it into simulator log and returns formatted error
+func handleErr(l *log.Logger, format string, params ...interface{}) error {
+	err := fmt.Errorf(format, params...)
+	l.Println(err)
+	return err
+}
+
+// Simulator - the interface to simulator engine
+type Simulator struct {
+	Options
+	message     string                     // current daemon status message
+	verbatim    bool                       // current message is shown without rendering
+	msgLock     sync.RWMutex               // message update lock
+	tail        chan struct{}              // closed when the last started simulation is finished
+	runs        map[int]context.CancelFunc // cancel functions of running and queued simulations
+	endless     map[int]struct{}           // endless simulations that are pre-empted by any next one
+	lastRun     int                        // last simulation id
+	runLock     sync.Mutex                 // running simulations lock
+	simulations map[string][]event         // simulation sequences
+	logger      io.Writer                  // daemon synchronization log
+	logLock     sync.Mutex                 // synchronization log writing lock
+	steps       chan chan struct{}         // step requests in stepping mode
+	stepLock    sync.Mutex                 // step requests lock
+	running     atomic.Int32               // number of running and queued simulations
+	changed     chan struct{}              // closed and replaced on every change of message or running
+	subs        map[chan Update]struct{}   // subscribers for updates
+	subLock     sync.Mutex                 // subscribers lock
+	closed      bool                       // simulator is closed, no more updates
+	history     []Update                   // last updates
+	quota       *Quota                     // quota values that replace the original ones
+	offline     context.CancelFunc         // cancels the network loss simulation
+	expired     context.CancelFunc         // cancels the authorization error simulation
+	stats       commandStats               // statistics of received commands
+}
+
+// Update is a notification about status transition, cli.log writing or received command
+type Update struct {
+	Time    time.Time `json:"time"`            // time of update
+	Type    string    `json:"type"`            // update type: "status", "log" or "command"
+	State   string    `json:"state,omitempty"` // core status for "status" update
+	Message string    `json:"message"`         // status message, cli.log line or received command
+}
+
+// NewSimulator - constructor of new Simulator
+func NewSimulator(logger io.Writer, opts Options) *Simulator {
+	return &Simulator{
+		Options:     opts.withDefaults(),
+		logger:      logger,
+		message:     " ",
+		simulations: simSet,
+		tail:        closedChan(),
+		runs:        make(map[int]context.CancelFunc),
+		endless:     make(map[int]struct{}),
+		steps:       make(chan chan struct{}),
+		changed:     make(chan struct{}),
+		subs:        make(map[chan Update]struct{}),
+	}
+}
+
+// closedChan returns the closed channel
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// setMsg is thread safe message update
+func (s *Simulator) setMsg(m string) {
+	s.setMessage(m, false)
+}
+
+// setMessage is thread safe message update. The verbatim message isn't rendered.
+func (s *Simulator) setMessage(m string, verbatim bool) {
+	s.msgLock.Lock()
+	s.message = m
+	s.verbatim = verbatim
+	m = s.quota.apply(m)
+	s.msgLock.Unlock()
+	s.notify()
+	s.publish(Update{Time: s.Clock.Now(), Type: "status", State: stateOf(m), Message: s.render(m)})
+}
+
+// logEvent writes the event message into simulator log and the cli.log entries of
+// transition from the prev status message to the event message into cli.log.
+// The recorded cli.log lines of replay are written into cli.log verbatim.
+func (s *Simulator) logEvent(set, prev string, e event) {
+	if e.logMsg != "" {
+		s.Log.Println(e.logMsg)
+	}
+	var lines []string
+	switch {
+	case set != ReplaySet:
+		lines = s.entries(prev, e)
+	case e.entry != "":
+		lines = []string{e.entry}
+	}
+	if len(lines) > 0 {
+		s.writeLog(lines)
+	}
+}
+
+// writeLog writes the lines into cli.log by one write. The cli.log writing error
+// is reported into simulator log and switches the daemon status to the log access error.
+func (s *Simulator) writeLog(lines []string) {
+	s.logLock.Lock()
+	_, err := s.logger.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	s.logLock.Unlock()
+	if err != nil {
+		handleErr(s.Log, "cli.log writing error: %w", err)
+		s.setMsg(msgLogError)
+		return
+	}
+	for _, l := range lines {
+		s.publish(Update{Time: s.Clock.Now(), Type: "log", Message: l})
+	}
+}
+
+// publish sends the update to all subscribers. The update is dropped for the
+// subscriber that doesn't read its updates in time.
+func (s *Simulator) publish(u Update) {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	if len(s.history) == historyLength {
+		s.history = slices.Delete(s.history, 0, 1)
+	}
+	s.history = append(s.history, u)
+	for ch := range s.subs {
+		select {
+		case ch <- u:
+		default:
+			s.Log.Println("Update dropped for slow subscriber:", u.Type, u.State)
+		}
+	}
+}
+
+// Subscribe returns the channel of updates and the function to cancel the subscription.
+// The channel is closed when the subscription is cancelled or the simulator is closed.
+func (s *Simulator) Subscribe() (<-chan Update, func()) {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	ch := make(chan Update, updatesBuffer)
+	if s.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	s.subs[ch] = struct{}{}
+	return ch, func() {
+		s.subLock.Lock()
+		defer s.subLock.Unlock()
+		if _, ok := s.subs[ch]; ok {
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close closes all subscriptions
+func (s *Simulator) Close() {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	s.closed = true
+	for ch := range s.subs {
+		delete(s.subs, ch)
+		close(ch)
+	}
+}
+
+// halt cancels all running and queued simulations and stops the cli.log writing as
+// the abnormal daemon exit does
+func (s *Simulator) halt() {
+	s.logLock.Lock()
+	s.logger = io.Discard
+	s.logLock.Unlock()
+	s.runLock.Lock()
+	for _, c := range s.runs {
+		c()
+	}
+	s.runLock.Unlock()
+}
+
+// notify wakes up all waiters for a change
+func (s *Simulator) notify() {
+	s.msgLock.Lock()
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.msgLock.Unlock()
+}
+
+// wait waits until the condition becomes true or the timeout expires.
+// The timeout is measured by system time as it protects the waiting clients.
+// It returns the last checked condition value.
+func (s *Simulator) wait(cond func() bool, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.msgLock.RLock()
+		changed := s.changed
+		s.msgLock.RUnlock()
+		if cond() {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return cond()
+		}
+	}
+}
+
+// WaitState waits until the daemon state becomes the required one or the timeout expires.
+// It returns true when the state is reached.
+func (s *Simulator) WaitState(state string, timeout time.Duration) bool {
+	return s.wait(func() bool { return s.State() == state }, timeout)
+}
+
+// WaitFinished waits until all running and queued simulations are finished or the
+// timeout expires. It returns true when all simulations are finished.
+func (s *Simulator) WaitFinished(timeout time.Duration) bool {
+	return s.wait(func() bool { return s.running.Load() == 0 }, timeout)
+}
+
+// Simulate starts the set of events simulation in background context (see SimulateContext)
+func (s *Simulator) Simulate(set string) error {
+	return s.SimulateContext(context.Background(), set)
+}
+
+// SimulateContext starts the set of events simulation. The simulation is cancelled
+// when the context is done.
+// The set must be one of: "Start", "Synchronization", "Error" OR "Stop"
+// The "Synchronization" set is replaced by its variant for current synchronization mode.
+// The set policy defines how the new simulation treats running and queued simulations.
+// Error is returned when the set is unknown or the simulation is rejected.
+func (s *Simulator) SimulateContext(ctx context.Context, set string) error {
+	pol := s.policy(set)
+	if set == syncSets[ModeNormal] {
+		set = syncSets[s.Mode]
+	}
+	sequence, ok := s.simulations[set]
+	if !ok {
+		return fmt.Errorf("unknown simulation '%s'", set)
+	}
+	return s.run(ctx, set, pol, slices.Values(sequence))
+}
+
+// run starts the simulation of events sequence of the set according to the start policy
+func (s *Simulator) run(ctx context.Context, set string, pol Policy, sequence iter.Seq[event]) error {
+	return s.start(ctx, set, pol, sequence, false)
+}
+
+// start starts the simulation of events sequence of the set according to the start policy.
+// The endless simulation is cancelled by the start of any next simulation whatever its
+// policy is, otherwise the queued simulations would never start.
+func (s *Simulator) start(ctx context.Context, set string, pol Policy, sequence iter.Seq[event], endless bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s.runLock.Lock()
+	switch pol {
+	case PolicyReject:
+		if len(s.runs) > len(s.endless) {
+			s.runLock.Unlock()
+			cancel()
+			return fmt.Errorf("%s simulation is rejected: other simulation is in progress", set)
+		}
+	case PolicyReplace:
+		for _, c := range s.runs {
+			c()
+		}
+	}
+	for id := range s.endless {
+		s.runs[id]()
+		delete(s.endless, id)
+	}
+	s.lastRun++
+	id := s.lastRun
+	s.runs[id] = cancel
+	if endless {
+		s.endless[id] = struct{}{}
+	}
+	s.running.Add(1)
+	// simulations are chained in the order of their start
+	prev, next := s.tail, make(chan struct{})
+	s.tail = next
+	s.runLock.Unlock()
+
+	// run simulation in separate goroutine
+	go func(seq iter.Seq[event]) {
+		defer close(next)
+		// wait for the end of previous simulations
+		<-prev
+		if ctx.Err() != nil {
+			s.finish(id, set+" simulation cancelled")
+			return
+		}
+		var d time.Duration
+		for e := range seq {
+			done, ok := s.advance(ctx, d)
+			if !ok {
+				s.finish(id, set+" simulation cancelled")
+				return
+			}
+			prev := s.rawMessage()
+			// the empty message of generated or recorded events means unchanged status,
+			// the recorded messages are shown verbatim
+			if e.msg != "" {
+				s.setMessage(e.msg, set == ReplaySet)
+			}
+			s.logEvent(set, prev, e)
+			done()
+			d = e.duration
+		}
+		// at the end of simulation set the idle/synchronized status message. The stop
+		// simulation is finished by the daemon exit without status change.
+		done, ok := s.advance(ctx, d)
+		if !ok {
+			s.finish(id, set+" simulation cancelled")
+			return
+		}
+		if set == "Stop" {
+			s.Log.Println(set + " simulation finished")
+		} else {
+			prev := s.rawMessage()
+			s.setMsg(msgIdle)
+			s.logEvent(set, prev, event{msg: msgIdle, logMsg: set + " simulation finished"})
+		}
+		s.finish(id, "")
+		done()
+	}(sequence)
+	return nil
+}
+
+// policy returns the start policy of the simulation set
+func (s *Simulator) policy(set string) Policy {
+	if p, ok := s.Policies[set]; ok {
+		return p
+	}
+	return simPolicies[set]
+}
+
+// finish removes the finished simulation from running ones and writes the message
+// into simulator log when it is not empty
+func (s *Simulator) finish(id int, msg string) {
+	s.runLock.Lock()
+	s.runs[id]()
+	delete(s.runs, id)
+	delete(s.endless, id)
+	s.running.Add(-1)
+	s.runLock.Unlock()
+	if msg != "" {
+		s.Log.Println(msg)
+	}
+	s.notify()
+}
+
+// advance waits for the permission to make the next transition: it waits for
+// the scaled duration d by the simulation clock in normal mode or waits for the Step call in stepping mode.
+// The returned function must be called after the transition is made.
+// It returns false when the context is done before the permission is received.
+func (s *Simulator) advance(ctx context.Context, d time.Duration) (func(), bool) {
+	if !s.Stepping {
+		select {
+		case <-s.Clock.After(Scale(d, s.Scale)):
+			return func() {}, ctx.Err() == nil
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	select {
+	case ack := <-s.steps:
+		return func() { close(ack) }, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// Step makes the next transition of the running simulation in stepping mode and
+// returns after the transition is made. It returns false when there is no
+// running simulation.
+func (s *Simulator) Step() bool {
+	s.stepLock.Lock()
+	defer s.stepLock.Unlock()
+	ack := make(chan struct{})
+	for {
+		s.msgLock.RLock()
+		changed := s.changed
+		s.msgLock.RUnlock()
+		if s.running.Load() == 0 {
+			return false
+		}
+		select {
+		case s.steps <- ack:
+			<-ack
+			return true
+		case <-changed: // running simulation could be cancelled
+		}
+	}
+}
+
+// State returns the current synchronization core status, e.g. "idle", or "" when
+// the status message has no core status.
+func (s *Simulator) State() string {
+	return stateOf(s.rawMessage())
+}
+
+// stateOf returns the synchronization core status from the status message
+func stateOf(msg string) string {
+	_, state, found := strings.Cut(msg, statePrefix)
+	if !found {
+		return ""
+	}
+	state, _, _ = strings.Cut(state, "\n")
+	return state
+}
+
+// GetMessage returns the current status message rendered by the output profile and
+// translated by the message catalog
+func (s *Simulator) GetMessage() string {
+	return s.render(s.rawMessage())
+}
+
+// rawMessage returns the current status message with replaced quota values but without rendering
+func (s *Simulator) rawMessage() string {
+	s.msgLock.RLock()
+	defer s.msgLock.RUnlock()
+	return s.quota.apply(s.message)
+}
+
+// render returns the status message rendered by the output profile unless the current
+// message is verbatim one. The core status is detected in not rendered message.
+func (s *Simulator) render(m string) string {
+	s.msgLock.RLock()
+	verbatim := s.verbatim
+	s.msgLock.RUnlock()
+	if verbatim {
+		return m
+	}
+	return s.Profile.Render(m)
+}
@@ -0,0 +1,622 @@
+package simulator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// try to step when there is no running simulation
+func TestSimulatorStepNothingToStep(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 1, Stepping: true})
+	require.False(t, sim.Step())
+}
+
+// check the cli.log entries of synchronization in read-only and overwrite modes
+func TestSimulateReadOnlySync(t *testing.T) {
+	for mode, lines := range map[SyncMode][]string{
+		ModeReadOnly: {
+			"INFO  Synchronization core status: index",
+			"INFO  Synchronization core status: busy",
+			"INFO  Sync progress: 0 MB/ 74.04 MB (0 %)",
+			"WARN  Local changes of 'NewFile' are not uploaded: read-only mode",
+			"INFO  Synchronization core status: index",
+			"INFO  Sync progress: 74.04 MB/ 74.04 MB (100 %)",
+			"INFO  Synchronization core status: idle",
+		},
+		ModeOverwrite: {
+			"INFO  Synchronization core status: index",
+			"INFO  Synchronization core status: busy",
+			"INFO  Sync progress: 0 MB/ 74.04 MB (0 %)",
+			"WARN  Local changes of 'NewFile' are overwritten by its version from Yandex.Disk",
+			"INFO  Synchronization core status: index",
+			"INFO  Sync progress: 74.04 MB/ 74.04 MB (100 %)",
+			"INFO  Downloaded file: 'NewFile'",
+			"INFO  Synchronization core status: idle",
+		},
+	} {
+		r, w := io.Pipe()
+		sim := NewSimulator(w, Options{Mode: mode, Scale: 1})
+		sim.Simulate("Synchronization")
+		scanner := bufio.NewScanner(r)
+		for _, line := range lines {
+			require.True(t, scanner.Scan())
+			entry := scanner.Text()
+			_, err := time.Parse(cliLogTime, entry[:len(cliLogTime)])
+			require.NoError(t, err)
+			require.Equal(t, line, entry[len(cliLogTime)+1:])
+		}
+		require.Contains(t, sim.GetMessage(), "Synchronization core status: idle")
+		if mode == ModeReadOnly {
+			require.NotContains(t, sim.GetMessage(), "NewFile")
+		}
+	}
+}
+
+// check the time scale factor parsing
+func TestParseTimeScale(t *testing.T) {
+	f, err := ParseTimeScale("")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, f)
+	f, err = ParseTimeScale("0.1")
+	require.NoError(t, err)
+	require.Equal(t, 0.1, f)
+	for _, v := range []string{"fast", "0", "-2", "NaN", "Inf", "+Inf", "1e400"} {
+		_, err = ParseTimeScale(v)
+		require.EqualError(t, err, "incorrect time scale factor '"+v+"': positive number expected")
+	}
+	// zero factor of options means the real time durations
+	require.Equal(t, 1.0, NewSimulator(io.Discard, Options{}).Scale)
+}
+
+// check that scaled synchronization simulation is faster than normal one
+func TestSimulateScaled(t *testing.T) {
+	r, w := io.Pipe()
+	sim := NewSimulator(w, Options{Scale: 0.1})
+	start := time.Now()
+	sim.Simulate("Synchronization")
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.HasSuffix(scanner.Text(), " INFO  Synchronization core status: idle") {
+			break
+		}
+	}
+	require.Less(t, time.Since(start), 500*time.Millisecond) // it takes 3s with factor 1
+	require.Contains(t, sim.GetMessage(), "Synchronization core status: idle")
+}
+
+// check the simulation policies parsing
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("")
+	require.NoError(t, err)
+	require.Empty(t, policies)
+	policies, err = ParsePolicies("Synchronization=reject,Error=queue,Start=replace,Chaos=reject")
+	require.NoError(t, err)
+	require.Equal(t, map[string]Policy{"Synchronization": PolicyReject, "Error": PolicyQueue, "Start": PolicyReplace, "Chaos": PolicyReject}, policies)
+	for _, v := range []string{"Sync=reject", "Error=cancel", "Stop=queue", "Error"} {
+		_, err = ParsePolicies(v)
+		require.EqualError(t, err, "incorrect simulation policy '"+v+"': <set>=queue|replace|reject expected")
+	}
+}
+
+// check the queue, replace and reject policies and stop pre-emption
+func TestSimulatePolicies(t *testing.T) {
+	t.Run("queue", func(t *testing.T) {
+		sim := NewSimulator(io.Discard, Options{Scale: 1})
+		require.NoError(t, sim.Simulate("Start"))
+		require.NoError(t, sim.Simulate("Synchronization"))
+		require.Equal(t, int32(2), sim.running.Load())
+		require.False(t, sim.WaitState("index", 100*time.Millisecond))
+		require.NoError(t, sim.Simulate("Stop"))
+		require.True(t, sim.WaitFinished(time.Second))
+	})
+	t.Run("replace", func(t *testing.T) {
+		sim := NewSimulator(io.Discard, Options{Scale: 1})
+		require.NoError(t, sim.Simulate("Start"))
+		require.NoError(t, sim.Simulate("Error"))
+		require.True(t, sim.WaitState("error", 100*time.Millisecond))
+		require.Equal(t, int32(1), sim.running.Load())
+		require.True(t, sim.WaitState("idle", time.Second))
+	})
+	t.Run("reject", func(t *testing.T) {
+		sim := NewSimulator(io.Discard, Options{Scale: 1, Policies: map[string]Policy{"Synchronization": PolicyReject}})
+		require.NoError(t, sim.Simulate("Start"))
+		require.EqualError(t, sim.Simulate("Synchronization"), "Synchronization simulation is rejected: other simulation is in progress")
+		require.Equal(t, "Error: Synchronization simulation is rejected: other simulation is in progress", sendCommand(t, sim, "sync"))
+		require.NoError(t, sim.Simulate("Stop"))
+		require.True(t, sim.WaitFinished(time.Second))
+	})
+	t.Run("unknown", func(t *testing.T) {
+		sim := NewSimulator(io.Discard, Options{Scale: 1})
+		require.EqualError(t, sim.Simulate("Crash"), "unknown simulation 'Crash'")
+	})
+}
+
+// check the simulation cancellation by context
+func TestSimulateContextCancel(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 1, Stepping: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, sim.SimulateContext(ctx, "Synchronization"))
+	require.True(t, sim.Step())
+	require.Equal(t, "index", sim.State())
+	cancel()
+	require.True(t, sim.WaitFinished(time.Second))
+	require.False(t, sim.Step())
+	require.Equal(t, "index", sim.State())
+}
+
+// check that cli.log is reopened after deletion and rotation
+func TestLogFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, logDirName, logFileName)
+	l, err := openLogFile(filePath, log.Default())
+	require.NoError(t, err)
+	defer l.Close()
+	read := func(p string) string {
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(data)
+	}
+	_, err = l.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	require.Equal(t, "line 1\n", read(filePath))
+	// rotation
+	require.NoError(t, os.Rename(filePath, filePath+".1"))
+	_, err = l.Write([]byte("line 2\n"))
+	require.NoError(t, err)
+	require.Equal(t, "line 1\n", read(filePath+".1"))
+	require.Equal(t, "line 2\n", read(filePath))
+	// deletion with directory
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, logDirName)))
+	_, err = l.Write([]byte("line 3\n"))
+	require.NoError(t, err)
+	require.Equal(t, "line 3\n", read(filePath))
+}
+
+// try to open cli.log in not accessible path
+func TestLogFileOpenError(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, logDirName), nil, 0600))
+	_, err := openLogFile(filepath.Join(dir, logDirName, logFileName), log.Default())
+	require.Error(t, err)
+}
+
+// failingWriter is a writer that always fails
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk is full") }
+
+// check that cli.log writing error switches the status to error
+func TestSimulateLogWriteError(t *testing.T) {
+	sim := NewSimulator(failingWriter{}, Options{Scale: 1, Stepping: true})
+	require.NoError(t, sim.Simulate("Error"))
+	require.True(t, sim.Step())
+	require.Equal(t, msgLogError, sim.GetMessage())
+	require.True(t, sim.Step())
+	require.Equal(t, msgLogError, sim.GetMessage())
+	require.False(t, sim.Step())
+}
+
+// try to generate chaos simulation events by seed
+func TestChaosEvents(t *testing.T) {
+	events := chaosEvents(42)
+	require.Equal(t, events, chaosEvents(42))
+	require.NotEqual(t, events, chaosEvents(43))
+	require.Len(t, events, chaosLength)
+	require.Equal(t, "Chaos simulation started (seed 42)", events[0].logMsg)
+	for _, e := range events {
+		require.Contains(t, chaosStates, stateOf(e.msg))
+		require.GreaterOrEqual(t, e.duration, chaosMinDuration)
+		require.Less(t, e.duration, chaosMaxDuration)
+		if stateOf(e.msg) == "busy" {
+			require.Contains(t, e.msg, "Sync progress: ")
+		}
+		if stateOf(e.msg) == "error" {
+			require.Contains(t, e.msg, "\nError: ")
+		}
+	}
+}
+
+// try to generate Markov scenario events by seed
+func TestMarkovEvents(t *testing.T) {
+	m := *SoakScenario
+	m.Steps = 200
+	require.NoError(t, m.Validate())
+	events := slices.Collect(m.events(1))
+	require.Equal(t, events, slices.Collect(m.events(1)))
+	require.NotEqual(t, events, slices.Collect(m.events(2)))
+	require.Len(t, events, 200)
+	require.Equal(t, "idle", stateOf(events[0].msg))
+	states := map[string]int{}
+	for i, e := range events {
+		states[stateOf(e.msg)]++
+		require.GreaterOrEqual(t, e.duration, time.Duration(0), i)
+	}
+	// mostly idle, occasional synchronizations
+	require.Greater(t, states["idle"], states["error"])
+	require.Greater(t, states["index"], 0)
+	require.Greater(t, states["busy"], 0)
+
+	// endless scenario is finished by the consumer
+	m.Steps = 0
+	n := 0
+	for range m.events(1) {
+		if n++; n == 1000 {
+			break
+		}
+	}
+	require.Equal(t, 1000, n)
+}
+
+// try to sample dwell time distributions
+func TestDwellSample(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	require.Equal(t, time.Second, Dwell{Min: time.Second}.sample(r))
+	for range 100 {
+		d := Dwell{Min: time.Second, Max: 2 * time.Second}.sample(r)
+		require.True(t, d >= time.Second && d < 2*time.Second, d)
+		d = Dwell{Min: time.Second, Max: 3 * time.Second, Mean: time.Second}.sample(r)
+		require.True(t, d >= time.Second && d <= 3*time.Second, d)
+	}
+}
+
+// try to load correct and incorrect Markov scenarios
+func TestLoadMarkov(t *testing.T) {
+	dir := t.TempDir()
+	write := func(data string) string {
+		p := filepath.Join(dir, "scenario.json")
+		require.NoError(t, os.WriteFile(p, []byte(data), 0600))
+		return p
+	}
+	m, err := LoadMarkov(write(`{"start": "a", "steps": 3, "states": {
+		"a": {"status": "idle", "dwell": {"min": "1s", "max": "2s"}, "next": {"b": 1}},
+		"b": {"message": "Synchronization core status: busy\n", "log": "busy", "dwell": {"min": "1s", "mean": "5s"}, "next": {"a": 1, "b": 2}}}}`))
+	require.NoError(t, err)
+	require.Equal(t, 3, m.Steps)
+	require.Equal(t, Dwell{Min: time.Second, Max: 2 * time.Second}, m.States["a"].Dwell)
+	require.Equal(t, Dwell{Min: time.Second, Mean: 5 * time.Second}, m.States["b"].Dwell)
+	require.Equal(t, statePrefix+"idle\n"+msgTail(), m.States["a"].message("a"))
+
+	for data, msg := range map[string]string{
+		`{"start": "x", "states": {}}`:                                                             "incorrect scenario: unknown start state 'x'",
+		`{"start": "a", "states": {"a": {}}}`:                                                      "incorrect scenario: state 'a' has no transitions",
+		`{"start": "a", "states": {"a": {"next": {"b": 1}}}}`:                                      "incorrect scenario: unknown state 'b' in transitions of 'a'",
+		`{"start": "a", "states": {"a": {"next": {"a": 0}}}}`:                                      "incorrect scenario: not positive weight of transition 'a' -> 'a'",
+		`{"start": "a", "states": {"a": {"dwell": {"min": "2s", "max": "1s"}, "next": {"a": 1}}}}`: "incorrect scenario: wrong dwell time of state 'a'",
+		`{"start": "a", "steps": -1, "states": {"a": {"next": {"a": 1}}}}`:                         "incorrect scenario: negative number of steps",
+		`{"start": "a", "states": {"a": {"next": {"b": 1}}, "b": {"next": {"a": 1}}}}`:             "incorrect scenario: endless scenario has no state with positive dwell time",
+	} {
+		_, err = LoadMarkov(write(data))
+		require.EqualError(t, err, msg)
+	}
+	_, err = LoadMarkov(write(`{"start": "a", "states": {"a": {"dwell": {"min": "soon"}}}}`))
+	require.ErrorContains(t, err, "scenario parsing error: ")
+	_, err = LoadMarkov(filepath.Join(dir, "none.json"))
+	require.ErrorContains(t, err, "scenario reading error: ")
+}
+
+// try to cancel endless Markov scenario simulation
+func TestSimulateMarkovCancel(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 0.0001})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, sim.SimulateMarkov(ctx, SoakScenario, 3))
+	require.True(t, sim.WaitState("busy", 2*time.Second))
+	require.False(t, sim.WaitFinished(50*time.Millisecond))
+	cancel()
+	require.True(t, sim.WaitFinished(time.Second))
+	require.Error(t, sim.SimulateMarkov(ctx, &Markov{Start: "none"}, 3))
+}
+
+// try to run the queued simulation after the endless Markov scenario simulation
+func TestSimulateMarkovPreempted(t *testing.T) {
+	simLog := &lockedBuffer{}
+	sim := NewSimulator(io.Discard, Options{Scale: 0.0001, Log: log.New(simLog, "", 0)})
+	require.NoError(t, sim.SimulateMarkov(context.Background(), SoakScenario, 3))
+	require.True(t, sim.WaitState("busy", 2*time.Second))
+	require.Equal(t, PolicyQueue, sim.policy(MarkovSet))
+	// the reject policy doesn't treat the endless simulation as the one in progress
+	sim.Policies = map[string]Policy{"Synchronization": PolicyReject}
+	require.NoError(t, sim.Simulate("Synchronization"))
+	require.True(t, sim.WaitFinished(2*time.Second))
+	require.Contains(t, simLog.String(), "Markov simulation cancelled\n")
+	require.Contains(t, simLog.String(), "Synchronization simulation finished\n")
+	// the endless simulation is pre-empted by the queued one as well
+	require.NoError(t, sim.SimulateMarkov(context.Background(), SoakScenario, 3))
+	sim.Policies = nil
+	require.NoError(t, sim.Simulate("Synchronization"))
+	require.True(t, sim.WaitFinished(2*time.Second))
+}
+
+// fakeYandexDisk creates the fake yandex-disk utility that outputs the content of
+// status file in its directory as status and returns its path
+func fakeYandexDisk(t *testing.T) (exe, status string) {
+	dir := t.TempDir()
+	exe = filepath.Join(dir, "yandex-disk")
+	require.NoError(t, os.WriteFile(exe, []byte("#!/bin/sh\ncat \"$(dirname \"$0\")/status\"\n"), 0700))
+	return exe, filepath.Join(dir, "status")
+}
+
+// try to record the fake yandex-disk output and replay it
+func TestRecordReplay(t *testing.T) {
+	exe, status := fakeYandexDisk(t)
+	cliLog := filepath.Join(t.TempDir(), "cli.log")
+	require.NoError(t, os.WriteFile(status, []byte("Synchronization core status: idle\n"), 0600))
+	require.NoError(t, os.WriteFile(cliLog, []byte("old line\n"), 0600))
+	appendLog := func(s string) {
+		f, err := os.OpenFile(cliLog, os.O_APPEND|os.O_WRONLY, 0600)
+		require.NoError(t, err)
+		_, err = f.WriteString(s)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	var rec *Recording
+	var err error
+	done := make(chan struct{})
+	go func() {
+		rec, err = Record(ctx, exe, cliLog, 10*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, os.WriteFile(status, []byte("Synchronization core status: busy\n"), 0600))
+	appendLog("line 1\nline")
+	time.Sleep(100 * time.Millisecond)
+	appendLog(" 2\n")
+	<-done
+	require.NoError(t, err)
+
+	var msgs, logs []string
+	var total time.Duration
+	for _, e := range rec.Events {
+		if e.Message != "" {
+			msgs = append(msgs, e.Message)
+		}
+		if e.Log != "" {
+			logs = append(logs, e.Log)
+		}
+		total += e.Duration
+	}
+	require.Equal(t, []string{"Synchronization core status: idle", "Synchronization core status: busy"}, msgs)
+	require.Equal(t, []string{"line 1", "line 2"}, logs)
+	require.InDelta(t, 500*time.Millisecond, total, float64(100*time.Millisecond))
+
+	file := filepath.Join(t.TempDir(), "recording.json")
+	require.NoError(t, rec.Save(file))
+	loaded, err := LoadRecording(file)
+	require.NoError(t, err)
+	require.Equal(t, rec, loaded)
+
+	// replay reproduces the recorded messages and cli.log lines
+	out := &strings.Builder{}
+	sim := NewSimulator(out, Options{Scale: 0.01})
+	updates, unsubscribe := sim.Subscribe()
+	defer unsubscribe()
+	require.NoError(t, sim.SimulateReplay(context.Background(), loaded))
+	require.True(t, sim.WaitFinished(time.Second))
+	require.Equal(t, "line 1\nline 2\n", out.String())
+	msgs = nil
+	for len(updates) > 0 {
+		if u := <-updates; u.Type == "status" {
+			msgs = append(msgs, u.Message)
+		}
+	}
+	require.Equal(t, []string{"Synchronization core status: idle", "Synchronization core status: busy", msgIdle}, msgs)
+
+	// the recorded messages aren't rendered by the profile
+	sim = NewSimulator(io.Discard, Options{Scale: 0.01, Profile: Profiles["0.1.5"]})
+	require.NoError(t, sim.SimulateReplay(context.Background(), loaded))
+	require.True(t, sim.WaitState("busy", time.Second))
+	require.Equal(t, "Synchronization core status: busy", sim.GetMessage())
+
+	require.EqualError(t, sim.SimulateReplay(context.Background(), &Recording{}), "recording has no events")
+	_, err = Record(context.Background(), filepath.Join(t.TempDir(), "none"), cliLog, time.Millisecond)
+	require.ErrorContains(t, err, "status command error: ")
+	// the hung status command is interrupted at the end of recording
+	require.NoError(t, os.WriteFile(exe, []byte("#!/bin/sh\nexec sleep 10\n"), 0700))
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	rec, err = Record(ctx, exe, cliLog, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Empty(t, rec.Events)
+	require.Less(t, time.Since(start), 2*time.Second)
+	_, err = LoadRecording(filepath.Join(t.TempDir(), "none"))
+	require.ErrorContains(t, err, "recording reading error: ")
+}
+
+// try to render messages by output profiles
+func TestProfile(t *testing.T) {
+	p, err := ParseProfile("")
+	require.NoError(t, err)
+	require.Nil(t, p)
+	msg := simSet["Synchronization"][2].msg
+	require.Equal(t, msg, p.Render(msg))
+	require.Equal(t, "Error: daemon not started", p.Text("Error: daemon not started"))
+	_, err = ParseProfile("1.0")
+	require.EqualError(t, err, "unknown profile '1.0': one of 0.1.5, 0.1.6 expected")
+
+	p, err = ParseProfile("0.1.6")
+	require.NoError(t, err)
+	require.Equal(t, msg, p.Render(msg))
+
+	p, err = ParseProfile("0.1.5")
+	require.NoError(t, err)
+	rendered := p.Render(msg)
+	require.True(t, strings.HasPrefix(rendered, "Synchronization core status: busy\nSync progress: 65.34 MB/ 139.38 MB (46 %)\n"), rendered)
+	require.Contains(t, rendered, "\nLast synchronized files:\n")
+	require.Equal(t, "busy", stateOf(rendered))
+	require.Contains(t, p.Render(simSet["Start"][1].msg), "\tQuota information is not received yet.\n")
+	require.Equal(t, "Error: daemon is not running", p.Text("Error: daemon not started"))
+
+	sim := NewSimulator(io.Discard, Options{Scale: 0.01, Profile: p})
+	sim.Simulate("Synchronization")
+	require.True(t, sim.WaitFinished(time.Second))
+	require.Contains(t, sim.GetMessage(), "\nLast synchronized files:\n")
+}
+
+// try to translate messages by catalogs
+func TestCatalog(t *testing.T) {
+	require.Nil(t, LocaleCatalog(""))
+	require.Nil(t, LocaleCatalog("C"))
+	require.Nil(t, LocaleCatalog("en_US.UTF-8"))
+	require.Equal(t, Catalogs["uk"], LocaleCatalog("uk_UA.UTF-8"))
+	c := LocaleCatalog("ru_RU.UTF-8")
+	require.Equal(t, Catalogs["ru"], c)
+	require.Equal(t, "Ошибка: демон не запущен", c.Text("Error: daemon not started"))
+	require.Equal(t, "Ошибка: неизвестная команда: 'wrongCMD'", c.Text("Error: unknown command: 'wrongCMD'"))
+	require.Equal(t, "Error: daemon not started", (*Catalog)(nil).Text("Error: daemon not started"))
+	require.Equal(t, "Готово", c.Message("Done"))
+	require.Equal(t, "Done", (*Catalog)(nil).Message("Done"))
+	// the paths and file names are kept as they are
+	require.Equal(t, "Ошибка: ошибка доступа\nПуть: 'Done/access error'\n\tфайл: 'Error: Fail'",
+		c.Text("Error: access error\nPath: 'Done/access error'\n\tfile: 'Error: Fail'"))
+	require.Equal(t, "Ошибка: token file reading error: open /tmp/Done: no such file", c.Text("Error: token file reading error: open /tmp/Done: no such file"))
+
+	// the rendered status message is translated by client
+	sim := NewSimulator(io.Discard, Options{Scale: 0.01, Profile: Profiles["0.1.5"]})
+	updates, unsubscribe := sim.Subscribe()
+	defer unsubscribe()
+	sim.Simulate("Error")
+	require.True(t, sim.WaitState("error", time.Second))
+	msg := c.Text(sim.GetMessage())
+	require.True(t, strings.HasPrefix(msg, "Статус ядра синхронизации: error\nОшибка: ошибка доступа\nПуть: 'downloads/test1'\nПуть к папке Яндекс.Диска:"), msg)
+	require.Contains(t, msg, "\nПоследние синхронизированные файлы:\n\tфайл: 'File.ods'\n")
+	u := <-updates
+	require.Equal(t, "error", u.State)
+	require.Equal(t, msg, c.Text(u.Message))
+}
+
+// check the cli.log entries of status transitions
+func TestEntries(t *testing.T) {
+	clock := &instantClock{now: time.Date(2020, 1, 2, 3, 4, 5, 600_000_000, time.UTC)}
+	sim := NewSimulator(io.Discard, Options{Scale: 1, Clock: clock})
+	sync := simSet["Synchronization"]
+	require.Equal(t, []string{
+		"2020-01-02 03:04:05.600 INFO  Synchronization core status: index",
+		"2020-01-02 03:04:05.600 INFO  Sync progress: 139.38 MB/ 139.38 MB (100 %)",
+		"2020-01-02 03:04:05.600 INFO  Uploaded file: 'NewFile'",
+		"2020-01-02 03:04:05.600 WARN  Disk is almost full",
+	}, sim.entries(sync[2].msg, event{msg: sync[3].msg, entry: "WARN Disk is almost full"}))
+	require.Equal(t, []string{
+		"2020-01-02 03:04:05.600 INFO  Synchronization core status: idle",
+	}, sim.entries(sync[3].msg, event{msg: msgIdle}))
+	require.Equal(t, []string{
+		"2020-01-02 03:04:05.600 INFO  Synchronization core status: error",
+		"2020-01-02 03:04:05.600 ERROR access error: 'downloads/test1'",
+	}, sim.entries(msgIdle, simSet["Error"][0]))
+	// unchanged status message gives no entries
+	require.Empty(t, sim.entries(msgIdle, event{}))
+	sim.Mode = ModeOverwrite
+	require.Contains(t, sim.entries(sync[2].msg, event{msg: sync[3].msg}), "2020-01-02 03:04:05.600 INFO  Downloaded file: 'NewFile'")
+}
+
+// check the typed status of status messages
+func TestParseStatus(t *testing.T) {
+	st := ParseStatus(simSet["Synchronization"][3].msg)
+	require.Equal(t, "index", st.State)
+	require.Equal(t, "139.38 MB/ 139.38 MB (100 %)", st.Progress)
+	require.Equal(t, "/home/stc/Yandex.Disk", st.Path)
+	require.Equal(t, &Quota{Total: "43.50 GB", Used: "2.89 GB", Available: "40.61 GB", MaxFileSize: "50 GB", TrashSize: "0 B"}, st.Quota)
+	require.Equal(t, "NewFile", st.LastItems[0])
+	require.Len(t, st.LastItems, 10)
+	st = ParseStatus(simSet["Error"][0].msg)
+	require.Equal(t, "access error", st.Error)
+	require.Equal(t, "downloads/test1", st.ErrorPath)
+	st = ParseStatus(simSet["Start"][2].msg)
+	require.Nil(t, st.Quota)
+	require.Empty(t, st.LastItems)
+	require.Equal(t, Status{State: "", Message: " "}, ParseStatus(" "))
+}
+
+// try to set the sync progress and to toggle the network loss
+func TestManualControl(t *testing.T) {
+	var cliLog lockedBuffer
+	sim := NewSimulator(&cliLog, Options{Scale: 1, Clock: &instantClock{}, Log: log.New(io.Discard, "", 0)})
+	require.EqualError(t, sim.SimulateProgress(context.Background(), 101), "incorrect progress value '101': 0..100 expected")
+	require.NoError(t, sim.SimulateProgress(context.Background(), 50))
+	require.True(t, sim.WaitFinished(time.Second))
+	require.Contains(t, cliLog.String(), " INFO  Sync progress: 69.69 MB/ 139.38 MB (50 %)\n")
+	require.Equal(t, "idle", sim.State())
+
+	// the network loss lasts until the next toggle
+	sim = NewSimulator(io.Discard, Options{Scale: 1, Log: log.New(io.Discard, "", 0)})
+	offline, err := sim.ToggleNetwork(context.Background())
+	require.NoError(t, err)
+	require.True(t, offline)
+	require.True(t, sim.WaitState("no internet access", time.Second))
+	require.False(t, sim.WaitFinished(50*time.Millisecond))
+	offline, err = sim.ToggleNetwork(context.Background())
+	require.NoError(t, err)
+	require.False(t, offline)
+	require.True(t, sim.WaitState("index", time.Second))
+	require.Equal(t, 1, int(sim.running.Load()))
+
+	// the authorization error lasts until the token is restored
+	authLog := &lockedBuffer{}
+	sim = NewSimulator(authLog, Options{Scale: 1, Log: log.New(io.Discard, "", 0)})
+	require.NoError(t, sim.RestoreToken(context.Background()))
+	require.True(t, sim.WaitFinished(time.Second))
+	require.NoError(t, sim.ExpireToken(context.Background()))
+	require.True(t, sim.WaitState("error", time.Second))
+	require.Contains(t, sim.GetMessage(), "\nError: authorization error\n")
+	require.Contains(t, authLog.String(), " ERROR authorization error\n")
+	require.False(t, sim.WaitFinished(50*time.Millisecond))
+	require.NoError(t, sim.RestoreToken(context.Background()))
+	require.True(t, sim.WaitState("index", time.Second))
+	require.Equal(t, 1, int(sim.running.Load()))
+}
+
+// check that the history is bounded
+func TestHistoryLength(t *testing.T) {
+	sim := NewSimulator(io.Discard, Options{Scale: 1})
+	for i := range historyLength + 5 {
+		sim.LogCommand(strconv.Itoa(i))
+	}
+	history := sim.History()
+	require.Len(t, history, historyLength)
+	require.Equal(t, Update{Time: history[0].Time, Type: "command", Message: "5"}, history[0])
+	var b strings.Builder
+	require.NoError(t, WriteTimeline(&b, history[:1]))
+	require.Equal(t, history[0].Time.Format(cliLogTime)+" command 5\n", b.String())
+}
+
+// check the statistics of commands
+func TestCommandStats(t *testing.T) {
+	clock := &instantClock{now: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	sim := NewSimulator(io.Discard, Options{Scale: 1, Clock: clock})
+	for _, d := range []time.Duration{0, 200 * time.Millisecond, 200 * time.Millisecond, 1100 * time.Millisecond} {
+		<-clock.After(d)
+		sim.CountCommand("status")
+	}
+	sim.CountCommand("sync")
+	stats := sim.Stats()
+	exp := CommandStats{Count: 4, MaxPerSecond: 3, MinInterval: 200 * time.Millisecond, MeanInterval: 500 * time.Millisecond, MaxInterval: 1100 * time.Millisecond}
+	require.Equal(t, map[string]CommandStats{"status": exp, "sync": {Count: 1, MaxPerSecond: 1}}, stats)
+	data, err := json.Marshal(stats)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"status": {"count": 4, "max_per_second": 3, "min_interval": "200ms", "mean_interval": "500ms", "max_interval": "1.1s"},
+		"sync": {"count": 1, "max_per_second": 1, "min_interval": "0s", "mean_interval": "0s", "max_interval": "0s"}}`, string(data))
+	var parsed map[string]CommandStats
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	require.Equal(t, stats, parsed)
+	var b strings.Builder
+	require.NoError(t, WriteStats(&b, stats))
+	require.Equal(t, "status   4 requests, max 3 per second, interval min 200ms, mean 500ms, max 1.1s\n"+
+		"sync     1 requests, max 1 per second, interval min 0s, mean 0s, max 0s\n", b.String())
+}
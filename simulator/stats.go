@@ -0,0 +1,141 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CommandStats - the statistics of command requests. The intervals are measured between
+// consecutive requests of the command, they are zero when there was only one request.
+// In JSON the durations are strings like "1.5s".
+type CommandStats struct {
+	Count        int           // number of requests
+	MaxPerSecond int           // maximal number of requests within one second
+	MinInterval  time.Duration // minimal interval between requests
+	MeanInterval time.Duration // mean interval between requests
+	MaxInterval  time.Duration // maximal interval between requests
+}
+
+// commandStatsJSON is the JSON form of CommandStats
+type commandStatsJSON struct {
+	Count        int    `json:"count"`
+	MaxPerSecond int    `json:"max_per_second"`
+	MinInterval  string `json:"min_interval"`
+	MeanInterval string `json:"mean_interval"`
+	MaxInterval  string `json:"max_interval"`
+}
+
+// MarshalJSON writes the statistics with durations as strings
+func (cs CommandStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(commandStatsJSON{cs.Count, cs.MaxPerSecond, cs.MinInterval.String(), cs.MeanInterval.String(), cs.MaxInterval.String()})
+}
+
+// UnmarshalJSON parses the statistics with durations as strings
+func (cs *CommandStats) UnmarshalJSON(data []byte) error {
+	var v commandStatsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*cs = CommandStats{Count: v.Count, MaxPerSecond: v.MaxPerSecond}
+	for _, f := range []struct {
+		value string
+		dst   *time.Duration
+	}{{v.MinInterval, &cs.MinInterval}, {v.MeanInterval, &cs.MeanInterval}, {v.MaxInterval, &cs.MaxInterval}} {
+		var err error
+		if *f.dst, err = time.ParseDuration(f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commandCounter counts the requests of one command
+type commandCounter struct {
+	CommandStats
+	first, last time.Time   // times of the first and the last requests
+	recent      []time.Time // times of requests within the last second
+}
+
+// add counts the request received at the time
+func (c *commandCounter) add(t time.Time) {
+	if c.Count > 0 {
+		d := t.Sub(c.last)
+		if c.Count == 1 || d < c.MinInterval {
+			c.MinInterval = d
+		}
+		c.MaxInterval = max(c.MaxInterval, d)
+		c.MeanInterval = t.Sub(c.first) / time.Duration(c.Count)
+	} else {
+		c.first = t
+	}
+	c.Count++
+	c.last = t
+	// keep only the requests received within the last second including this one
+	i := 0
+	for i < len(c.recent) && t.Sub(c.recent[i]) >= time.Second {
+		i++
+	}
+	c.recent = append(c.recent[i:], t)
+	c.MaxPerSecond = max(c.MaxPerSecond, len(c.recent))
+}
+
+// commandStats - the statistics of received commands
+type commandStats struct {
+	counters map[string]*commandCounter // counters by command names
+	lock     sync.Mutex                 // counters lock
+}
+
+// add counts the command request received at the time
+func (cs *commandStats) add(cmd string, t time.Time) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if cs.counters == nil {
+		cs.counters = make(map[string]*commandCounter)
+	}
+	c, ok := cs.counters[cmd]
+	if !ok {
+		c = &commandCounter{}
+		cs.counters[cmd] = c
+	}
+	c.add(t)
+}
+
+// get returns the statistics by command names
+func (cs *commandStats) get() map[string]CommandStats {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	res := make(map[string]CommandStats, len(cs.counters))
+	for cmd, c := range cs.counters {
+		res[cmd] = c.CommandStats
+	}
+	return res
+}
+
+// CountCommand counts the received command request for statistics
+func (s *Simulator) CountCommand(cmd string) {
+	s.stats.add(cmd, s.Clock.Now())
+}
+
+// Stats returns the statistics of received commands by their names
+func (s *Simulator) Stats() map[string]CommandStats {
+	return s.stats.get()
+}
+
+// WriteStats writes the commands statistics as text: one line per command in order
+// of command names. The intervals are rounded to milliseconds.
+func WriteStats(w io.Writer, stats map[string]CommandStats) error {
+	for _, cmd := range slices.Sorted(maps.Keys(stats)) {
+		cs := stats[cmd]
+		_, err := fmt.Fprintf(w, "%-8s %d requests, max %d per second, interval min %v, mean %v, max %v\n",
+			cmd, cs.Count, cs.MaxPerSecond, cs.MinInterval.Round(time.Millisecond), cs.MeanInterval.Round(time.Millisecond), cs.MaxInterval.Round(time.Millisecond))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// duration of injected error
+const errorTime = 500 * time.Millisecond
+
+// Quota - the disk space values shown in status message, e.g. "43.50 GB"
+type Quota struct {
+	Total       string `json:"total"`
+	Used        string `json:"used"`
+	Available   string `json:"available"`
+	MaxFileSize string `json:"max_file_size"`
+	TrashSize   string `json:"trash_size"`
+}
+
+// Status - the typed content of status message
+type Status struct {
+	State     string   `json:"state"`                // synchronization core status
+	Progress  string   `json:"progress,omitempty"`   // sync progress, e.g. "65.34 MB/ 139.38 MB (46 %)"
+	Error     string   `json:"error,omitempty"`      // error text of error state
+	ErrorPath string   `json:"error_path,omitempty"` // path of error
+	Path      string   `json:"path,omitempty"`       // synchronized directory path
+	Quota     *Quota   `json:"quota,omitempty"`      // disk space values, nil when the quota isn't received yet
+	LastItems []string `json:"last_items"`           // last synchronized items
+	Message   string   `json:"message"`              // status message as the status command outputs it
+}
+
+// ParseStatus returns the typed content of status message
+func ParseStatus(msg string) Status {
+	st := Status{
+		State:     stateOf(msg),
+		Progress:  lineOf(msg, "Sync progress: "),
+		Error:     lineOf(msg, "Error: "),
+		ErrorPath: strings.Trim(lineOf(msg, "Path: "), "'"),
+		Path:      strings.Trim(lineOf(msg, "Path to Yandex.Disk directory: "), "'"),
+		Message:   msg,
+	}
+	st.LastItems, _ = itemsOf(msg)
+	if total := lineOf(msg, "\tTotal: "); total != "" {
+		st.Quota = &Quota{
+			Total:       total,
+			Used:        lineOf(msg, "\tUsed: "),
+			Available:   lineOf(msg, "\tAvailable: "),
+			MaxFileSize: lineOf(msg, "\tMax file size: "),
+			TrashSize:   lineOf(msg, "\tTrash size: "),
+		}
+	}
+	return st
+}
+
+// apply returns the message with quota values replaced by q values. The message
+// without quota values and the nil q leave the message unchanged.
+func (q *Quota) apply(msg string) string {
+	if q == nil {
+		return msg
+	}
+	lines := strings.Split(msg, "\n")
+	for i, l := range lines {
+		for _, v := range []struct{ prefix, value string }{
+			{"\tTotal: ", q.Total},
+			{"\tUsed: ", q.Used},
+			{"\tAvailable: ", q.Available},
+			{"\tMax file size: ", q.MaxFileSize},
+			{"\tTrash size: ", q.TrashSize},
+		} {
+			if strings.HasPrefix(l, v.prefix) && v.value != "" {
+				lines[i] = v.prefix + v.value
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Status returns the typed current status. The message is rendered like GetMessage does.
+func (s *Simulator) Status() Status {
+	st := ParseStatus(s.rawMessage())
+	st.Message = s.render(st.Message)
+	return st
+}
+
+// SetQuota replaces the quota values of all status messages by q values (the empty
+// values stay unchanged). The nil q returns the original values.
+func (s *Simulator) SetQuota(q *Quota) {
+	s.msgLock.Lock()
+	s.quota = q
+	s.msgLock.Unlock()
+	s.notify()
+	m := s.rawMessage()
+	s.publish(Update{Time: s.Clock.Now(), Type: "status", State: stateOf(m), Message: s.render(m)})
+}
+
+// SimulateError starts the error simulation with the error text and path. The standard
+// "Error" set is simulated when the text is "".
+func (s *Simulator) SimulateError(ctx context.Context, text, path string) error {
+	if text == "" {
+		return s.SimulateContext(ctx, "Error")
+	}
+	e := event{
+		msg:      fmt.Sprintf("%serror\nError: %s\nPath: '%s'\n%s", statePrefix, text, path, msgTail()),
+		duration: errorTime,
+		logMsg:   "Error simulation: " + text,
+	}
+	return s.run(ctx, "Error", s.policy("Error"), slices.Values([]event{e}))
+}
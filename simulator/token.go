@@ -0,0 +1,64 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrTokenRejected is returned when the OAuth token doesn't match the valid token
+var ErrTokenRejected = errors.New("OAuth token has been rejected")
+
+// CheckToken checks the content of OAuth token file. Any token is valid when the
+// valid Token isn't set.
+func (d *Daemon) CheckToken() error {
+	if d.Token == "" {
+		return nil
+	}
+	data, err := os.ReadFile(d.TokenFile)
+	if err != nil {
+		return fmt.Errorf("token file reading error: %w", err)
+	}
+	if strings.TrimSpace(string(data)) != d.Token {
+		return ErrTokenRejected
+	}
+	return nil
+}
+
+// renewToken finishes the authorization error simulation and begins the token
+// lifetime again
+func (d *Daemon) renewToken() error {
+	if err := d.sim.RestoreToken(context.Background()); err != nil {
+		return err
+	}
+	d.expireToken()
+	return nil
+}
+
+// expireToken begins the token lifetime: the authorization error simulation is started
+// when it is over. The previous token lifetime is cancelled.
+func (d *Daemon) expireToken() {
+	if d.TokenExpiry <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.tokenLock.Lock()
+	if d.tokenCancel != nil {
+		d.tokenCancel()
+	}
+	d.tokenCancel = cancel
+	d.tokenLock.Unlock()
+	expired := d.sim.Clock.After(Scale(d.TokenExpiry, d.sim.Scale))
+	go func() {
+		select {
+		case <-expired:
+			if err := d.sim.ExpireToken(context.Background()); err != nil {
+				d.log.Println("Token expiry simulation error:", err)
+			}
+		case <-ctx.Done():
+		case <-d.quit:
+		}
+	}()
+}
@@ -6,7 +6,7 @@ package main
 // Yandex.Disk on linux platform).
 //
 // The simulator acts like real utility but with predictable results (see the
-// NewSimilator function in simulator.go file to see the simulation sequences).
+// simulator package to see the simulation sequences).
 //
 // The simulation re-produces only most common errors and fixed set of status messages.
 //
@@ -17,33 +17,105 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/slytomcat/yandex-disk-simulator/simulator"
 )
 
 var (
 	version       string
 	daemonLogFile = path.Join(os.TempDir(), "yandexdisksimulator.log")
-	socketPath    = path.Join(os.TempDir(), "yandexdisksimulator.socket")
+	socketPath    = cmp.Or(os.Getenv("Sim_Socket"), path.Join(os.TempDir(), "yandexdisksimulator.socket"))
+	httpAddr      = os.Getenv("Sim_HTTP")
 	verMsg        = "%s %s\n"
 	helpMsg       = `Usage:
-	%s <cmd>
+	%s [options] <cmd>
+Options:
+	--profile <release>	output profile of yandex-disk release: 0.1.5 or 0.1.6. It changes the
+		status messages, error texts and version output (default: simulator's own output)
 Commands:
 	start	starts the daemon and begin starting events simulation
+		Options:
+		--read-only	do not upload locally changed files to Yandex.Disk
+		--overwrite	overwrite locally changed files by their versions from
+				Yandex.Disk (only in read-only mode)
 	stop	stops the daemon
 	status	get the daemon status
 	sync	begin the synchronization events simulation
 	error   begin short time error simulation
+	chaos	begin the random walk through idle, index, busy, error, paused and no internet
+		access states with random durations and progress values
+		Options:
+		--seed <number>	seed of random values to reproduce the simulation exactly
+				(default: random seed, it is written into simulator log)
+	markov	begin the simulation of Markov scenario: random walk through the states of JSON
+		scenario file (the built-in soak scenario is used when the file isn't specified)
+		Options:
+		--seed <number>	seed of random values to reproduce the simulation exactly
+				(default: random seed, it is written into simulator log)
+		--steps <number>	number of states to go through (default: scenario steps,
+				0 - until the simulation is cancelled)
+	replay	begin the simulation of scenario file recorded by the record command
+	record	record the status changes and cli.log lines of yandex-disk utility into scenario file:
+		record <yandex-disk> <scenario file> [options]
+		Options:
+		--interval <duration>	status polling interval (default: 100ms)
+		--duration <duration>	recording duration (default: until Ctrl+C is pressed)
+		--cli-log <path>	cli.log path (default: cli.log in the configured synchronized directory)
+	progress	begin the busy status with the sync progress: progress <percent>
+	network	toggle the network loss: the no internet access status lasts until the next
+		network command that begins the synchronization simulation
+	console	open the terminal console that shows the status, recent transitions and cli.log lines
+		and sends the commands by keys: s - sync, e - error, c - chaos, m - markov,
+		p - progress +10%%, n - network on/off, t - step, x - stop daemon, q - quit
+	step	make the next transition of simulation (only when Sim_StepMode is set)
+	wait	wait until the daemon reaches the state: idle, index, busy, paused, error,
+		no internet access or finished (the end of all running and queued simulations)
+		Options:
+		--timeout <duration>	wait no longer than duration, e.g. 5s (default: 10s)
+	watch	output the status transitions, received commands and cli.log lines as JSON lines
+		until the daemon stops
+	history	output the history of last status transitions, received commands and cli.log lines
+		Options:
+		--jsonl	output the history as JSON lines, e.g. to attach it to the test report
+	stats	output the statistics of received commands: number of requests, maximal number
+		of requests per second and intervals between requests (they are written into
+		simulator log on stop as well)
+		Options:
+		--json	output the statistics as JSON
+	fault	inject the fault of daemon replies on the command to check the client timeouts:
+		fault <command> [options] - set the fault, fault <command> off - remove it,
+		fault off - remove all faults, fault - output the current faults
+		Options:
+		--latency <duration>	reply after the delay, e.g. 3s
+		--hang	never reply: keep the connection until the client closes it
+		--drop	close the connection without reply (after the latency)
+		--partial <bytes>	reply only the first bytes and close the connection
+	crash	exit the daemon abruptly: the running simulations are interrupted without the stop
+		simulation and the socket file is removed
+		Options:
+		--keep-socket	leave the socket file that refuses the connections
+		--truncate	leave the truncated line at the end of cli.log
+		--signal <name>	exit by the signal: KILL, TERM, INT or HUP (default: exit code 1)
+	token	write the OAuth token into the token file and make the running daemon check it:
+		token [<token>] (default: Sim_Token value or "token"). The daemon recovers from
+		the authorization error when the token is valid
 	help	output this help message and exit
 	version	output version information and exit
 	setup	prepares the simulation environment. It creates the configuration and
@@ -56,17 +128,49 @@ Simulator commands:
 Environment variables (used in setup):
 	Sim_SyncDir	can be used to set synchronized directory path (default: ~/Yandex.Disk)
 	Sim_ConfDir	can be used to set configuration directory path (default: ~/.config/yandex-disk)
+Environment variables (used in simulation):
+	LANG, LC_MESSAGES, LC_ALL	select the output language: ru or uk (default: English)
+	Sim_Socket	can be used to set the daemon socket path (default: $TMPDIR/yandexdisksimulator.socket)
+	Sim_HTTP	address of daemon's HTTP control server: <host>:<port> or unix socket path
+		that begins with / or . The web dashboard is served at / (default: no HTTP control server)
+	Sim_TimeScale	factor for all simulated durations, e.g. 0.1 makes the simulation
+		10 times faster and 2 makes it 2 times slower (default: 1)
+	Sim_Profile	output profile of yandex-disk release like the --profile option
+	Sim_StartFail	makes the daemon process fail after the start with the original error:
+		dir - synchronized directory isn't accessible, token - OAuth token is rejected,
+		instance - another instance is running, network - network is unavailable
+		(default: successful start)
+	Sim_Token	valid OAuth token: the daemon fails to start with other token in the token file
+		(default: any token is valid)
+	Sim_TokenExpiry	token lifetime since the start or the token command, e.g. 1h. The status
+		is switched to the authorization error when it is over (default: endless)
+	Sim_StepMode	when it is set to 1 (true) the simulation doesn't make transitions
+		by time but only by the step command (default: 0)
+	Sim_Policy	comma separated list of <set>=<policy> pairs where <set> is Start, Synchronization,
+		Error, Chaos, Markov, Replay, Progress, Network or Auth and <policy> defines how the
+		simulation treats the running ones: queue - wait for their end (default for all sets
+		except Error, Progress, Network and Auth), replace - cancel them (default for Error,
+		Progress, Network and Auth), reject - refuse to start.
+		Stop always cancels all running simulations.
+Exit codes (the errors are written into stderr):
+	0	success
+	1	other errors
+	2	command hasn't been specified, unknown command or option
+	3	daemon not started
+	4	configuration or synchronized directory is missing
+	5	file with OAuth token is missing or the token is rejected
 
 	version: %s
 `
 )
 
 const (
-	logDirName     = ".sync"
-	logFileName    = "cli.log"
-	configPath     = "$HOME/.config/yandex-disk"
-	configFileName = "config.cfg"
-	syncPath       = "$HOME/Yandex.Disk"
+	configPath = "$HOME/.config/yandex-disk"
+	syncPath   = "$HOME/Yandex.Disk"
+	// starting pause time
+	startTime = 500 * time.Millisecond
+	// default status polling interval of recording
+	recordInterval = 100 * time.Millisecond
 )
 
 // notExists returns true when specified file or path is not exists
@@ -77,19 +181,128 @@ func notExists(somePath string) bool {
 	return false
 }
 
+// exit codes of errors
+const (
+	exitFailure    = 1 // other errors
+	exitUsage      = 2 // command hasn't been specified, unknown command or option
+	exitNotStarted = 3 // daemon not started
+	exitConfig     = 4 // configuration or synchronized directory is missing
+	exitToken      = 5 // file with OAuth token is missing or the token is rejected
+)
+
+// exitError - the error with exit code of the utility
+type exitError struct {
+	msg  string // error message
+	code int    // exit code
+	err  error  // cause of the error (nil for the original product errors)
+}
+
+func (e *exitError) Error() string { return e.msg }
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// productErr returns the original product error with the exit code
+func productErr(code int, msg string) error {
+	return &exitError{msg: msg, code: code}
+}
+
+// errTokenRejected is the daemon start error when the OAuth token isn't valid
+var errTokenRejected = productErr(exitToken, "Error: OAuth token has been rejected.\nUse 'token' command to authenticate and create this file")
+
+// start failures selected by Sim_StartFail: the daemon process fails after the fork
+// with the original product error
+var startFailures = map[string]error{
+	"dir":      productErr(exitConfig, "Error: Indicated directory does not exist"),
+	"token":    errTokenRejected,
+	"instance": productErr(exitFailure, "Error: another instance of daemon is running"),
+	"network":  productErr(exitFailure, "Error: no internet access"),
+}
+
+// startFailure returns the start failure selected by Sim_StartFail (nil - the daemon
+// starts successfully) and the error of unknown failure
+func startFailure() (fail error, err error) {
+	name := os.Getenv("Sim_StartFail")
+	if name == "" {
+		return nil, nil
+	}
+	if fail = startFailures[name]; fail == nil {
+		return nil, fmt.Errorf("incorrect start failure '%s': dir, token, instance or network expected", name)
+	}
+	return fail, nil
+}
+
+// exitCode returns the exit code of the error: 0 for nil error and exitFailure
+// for the errors without particular exit code
+func exitCode(err error) int {
+	var e *exitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &e):
+		return e.code
+	default:
+		return exitFailure
+	}
+}
+
 // OS format main function
 func main() {
-	if err := doMain(os.Args...); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	err := doMain(os.Args...)
+	if err != nil {
+		// like the original utility the errors are reported into stderr
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if code := exitCode(err); code != 0 {
+		os.Exit(code)
 	}
 }
 
 // Go format of main function
 func doMain(args ...string) error {
+	// get the simulation options from environment and command line
+	opts, err := envOptions()
+	if err != nil {
+		return err
+	}
+	args, name := profileOption(args)
+	if name != "" {
+		if opts.Profile, err = simulator.ParseProfile(name); err != nil {
+			return err
+		}
+	}
+	// the output language is selected like the original utility does it
+	cat := simulator.LocaleCatalog(cmp.Or(os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")))
+	// the original product errors are rendered by the output profile and translated
+	if err = runCommand(opts, cat, args...); err != nil && (opts.Profile != nil || cat != nil) {
+		return &exitError{msg: cat.Text(opts.Profile.Text(err.Error())), code: exitCode(err), err: err}
+	}
+	return err
+}
+
+// profileOption returns the arguments without --profile option and the option value
+func profileOption(args []string) ([]string, string) {
+	var res []string
+	name := ""
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--profile" && i+1 < len(args):
+			i++
+			name = args[i]
+		case strings.HasPrefix(a, "--profile="):
+			name = strings.TrimPrefix(a, "--profile=")
+		default:
+			res = append(res, a)
+		}
+	}
+	return res, name
+}
+
+// runCommand executes the command with the simulation options and outputs the messages
+// translated by the message catalog
+func runCommand(opts simulator.Options, cat *simulator.Catalog, args ...string) error {
 	// check the number of arguments
 	if len(args) == 1 {
-		return fmt.Errorf("%s", "Error: command hasn't been specified. Use the --help command to access help\nor setup to launch the setup wizard.")
+		return productErr(exitUsage, "Error: command hasn't been specified. Use the --help command to access help\nor setup to launch the setup wizard.")
 	}
 
 	// open simulator log
@@ -112,222 +325,356 @@ func doMain(args ...string) error {
 	// handle command
 	switch cmd {
 	case "daemon":
-		return daemon(args[2])
+		if opts.Mode, err = parseMode(args[3:]); err != nil {
+			return err
+		}
+		return daemon(args[2], opts)
 	case "start":
-		return daemonize(args[0])
-	case "status", "stop", "sync", "error":
+		return daemonize(args[0], opts, cat, args[2:]...)
+	case "markov", "replay":
+		// the daemon may work in other directory so the scenario file path must be absolute
+		return handleCommand(cat, cmd, absScenario(args[2:])...)
+	case "record":
+		return record(args[2:]...)
+	case "token":
+		return token(args[2:]...)
+	case "console":
+		return console(cat)
+	case "status", "stop", "sync", "error", "chaos", "progress", "network", "step", "wait", "watch", "history", "stats", "fault", "crash":
 		// only listed commands will be passed to daemon
-		return handleCommand(cmd)
+		return handleCommand(cat, cmd, args[2:]...)
 	case "setup":
 		return setup()
 	case "-h", "--help", "help":
+		if p := opts.Profile; p != nil {
+			fmt.Print(p.Text(fmt.Sprintf(helpMsg, exe, version+" (yandex-disk "+p.Version+" profile)")))
+			return nil
+		}
 		fmt.Printf(helpMsg, exe, version)
 		return nil
 	case "version", "-v":
+		if opts.Profile != nil {
+			// the version of simulated release
+			fmt.Printf(verMsg, exe, opts.Profile.Version)
+			return nil
+		}
 		fmt.Printf(verMsg, exe, version)
 		return nil
 	default:
-		return fmt.Errorf("%s '%s'", "Error: unknown command:", cmd) // Original product error.
+		return productErr(exitUsage, fmt.Sprintf("%s '%s'", "Error: unknown command:", cmd)) // Original product error.
+	}
+}
+
+// envOptions returns the simulation options set by environment variables
+func envOptions() (simulator.Options, error) {
+	factor, err := simulator.ParseTimeScale(os.Getenv("Sim_TimeScale"))
+	if err != nil {
+		return simulator.Options{}, err
+	}
+	var stepping bool
+	if v := os.Getenv("Sim_StepMode"); v != "" {
+		if stepping, err = strconv.ParseBool(v); err != nil {
+			return simulator.Options{}, fmt.Errorf("incorrect step mode value '%s': boolean value expected", v)
+		}
+	}
+	policies, err := simulator.ParsePolicies(os.Getenv("Sim_Policy"))
+	if err != nil {
+		return simulator.Options{}, err
+	}
+	profile, err := simulator.ParseProfile(os.Getenv("Sim_Profile"))
+	if err != nil {
+		return simulator.Options{}, err
+	}
+	return simulator.Options{Scale: factor, Stepping: stepping, Policies: policies, Profile: profile}, nil
+}
+
+// parseMode returns the synchronization mode selected by the start options
+func parseMode(opts []string) (simulator.SyncMode, error) {
+	var readOnly, overwrite bool
+	for _, o := range opts {
+		switch o {
+		case "--read-only":
+			readOnly = true
+		case "--overwrite":
+			overwrite = true
+		default:
+			return simulator.ModeNormal, productErr(exitUsage, fmt.Sprintf("%s '%s'", "Error: unknown option:", o))
+		}
+	}
+	switch {
+	case readOnly && overwrite:
+		return simulator.ModeOverwrite, nil
+	case readOnly:
+		return simulator.ModeReadOnly, nil
+	default: // --overwrite has no effect without --read-only
+		return simulator.ModeNormal, nil
 	}
 }
 
 // daemonize starts the second instance of utility as a daemon process
-func daemonize(exe string) error {
+func daemonize(exe string, simOpts simulator.Options, cat *simulator.Catalog, opts ...string) error {
+
+	// check the start options before any other activity
+	if _, err := parseMode(opts); err != nil {
+		return err
+	}
 
 	// check configuration and get sync dir
-	dir, err := checkCfg()
+	dir, _, err := checkCfg()
 	if err != nil {
 		return err
 	}
+	if _, err = startFailure(); err != nil {
+		return err
+	}
 
 	// return in case when some other daemon is already started
 	if !notExists(socketPath) {
-		fmt.Println("Daemon is already running.")
+		fmt.Println(cat.Message("Daemon is already running."))
 		return nil
 	}
 
 	// output the daemon starting message
-	fmt.Print("Starting daemon process...")
+	fmt.Print(cat.Message("Starting daemon process..."))
 
 	// current executable name from os.Args[0] passed as exe parameter
-	// execute it with 'daemon' command and sync dir as second parameter
-	if err := exec.Command(exe, "daemon", dir).Start(); err != nil {
-		fmt.Println("Fail")
+	// execute it with 'daemon' command, sync dir as second parameter and start options after it
+	cmd := exec.Command(exe, append([]string{"daemon", dir}, opts...)...)
+	if simOpts.Profile != nil {
+		// the profile selected by --profile option is passed to daemon via environment
+		cmd.Env = append(os.Environ(), "Sim_Profile="+simOpts.Profile.Name)
+	}
+	// the daemon reports the start errors into stderr, the file is used instead of pipe
+	// as the daemon keeps it after the start
+	stderr, err := os.CreateTemp("", "yandexdisksimulator-*.stderr")
+	if err != nil {
+		return fmt.Errorf("daemon stderr file creation error: %w", err)
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Println(cat.Message("Fail"))
 		return err
 	}
-	// simulate the starting process
-	time.Sleep(startTime)
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	// simulate the starting process and catch the daemon failure during it
+	started := time.After(simulator.Scale(startTime, simOpts.Scale))
+	select {
+	case err = <-exited:
+		if err != nil {
+			fmt.Println(cat.Message("Fail"))
+			return daemonStartErr(stderr, err)
+		}
+		<-started // successful exit of started process isn't a failure
+	case <-started:
+	}
 
-	fmt.Println("Done")
+	fmt.Println(cat.Message("Done"))
 	return nil
 }
 
-// daemon is a daemonized instance of utility
-func daemon(syncDir string) error {
-	log.Println("Daemon started")
-	defer log.Println("Daemon stopped")
-
-	// create daemon's synchronization log path if it is not exists
-	logPath := path.Join(os.ExpandEnv(syncDir), logDirName)
-	err := os.MkdirAll(logPath, 0750)
+// daemonStartErr returns the error of daemon process that has exited during the start:
+// the error written by the daemon into stderr with the daemon exit code
+func daemonStartErr(stderr *os.File, exitErr error) error {
+	msg, err := os.ReadFile(stderr.Name())
 	if err != nil {
-		return fmt.Errorf("%s creation error: %w", logPath, err)
+		return fmt.Errorf("daemon stderr reading error: %w", err)
 	}
-	// open daemon's synchronization log file
-	logFilePath := path.Join(logPath, logFileName)
-	logFile, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return fmt.Errorf("%s opening error: %w", logFilePath, err)
+	code := exitFailure
+	var e *exec.ExitError
+	if errors.As(exitErr, &e) && e.ExitCode() > 0 {
+		code = e.ExitCode()
+	}
+	if len(bytes.TrimSpace(msg)) == 0 {
+		return productErr(code, "Error: daemon process has exited")
 	}
-	defer logFile.Close()
+	return productErr(code, string(bytes.TrimSpace(msg)))
+}
 
-	// open listening socket as server
-	ln, err := net.Listen("unix", socketPath)
-	if err != nil {
-		return handleErr("socket listener creation error: %w", err)
+// daemon is a daemonized instance of utility
+func daemon(syncDir string, opts simulator.Options) error {
+	// the simulated start failure is reported to parent like the preparation errors
+	if fail, err := startFailure(); fail != nil || err != nil {
+		return cmp.Or(fail, err)
+	}
+	d := &simulator.Daemon{SyncDir: syncDir, Socket: socketPath, HTTP: httpAddr, Options: opts, Token: os.Getenv("Sim_Token")}
+	if v := os.Getenv("Sim_TokenExpiry"); v != "" {
+		var err error
+		if d.TokenExpiry, err = time.ParseDuration(v); err != nil || d.TokenExpiry <= 0 {
+			return fmt.Errorf("incorrect token expiry '%s': positive duration expected", v)
+		}
 	}
-	defer func() {
-		ln.Close()
-		os.Remove(socketPath)
-	}()
+	// the token is validated when the valid token is set
+	if d.Token != "" {
+		var err error
+		if _, d.TokenFile, err = readCfg(); err != nil {
+			return err
+		}
+		switch err = d.CheckToken(); {
+		case errors.Is(err, simulator.ErrTokenRejected):
+			return errTokenRejected
+		case err != nil:
+			return err
+		}
+	}
+	// open the daemon's synchronization log and listening socket
+	if err := d.Listen(); err != nil {
+		return err
+	}
+	defer d.Close()
 
 	// disconnect from parent process to become a daemon process
 	// disconnecting as late as possible to report to parent about all preparation errors
-	if _, err = syscall.Setsid(); err != nil {
-		return handleErr("syscall.Setsid() error : %w", err)
+	if _, err := syscall.Setsid(); err != nil {
+		err = fmt.Errorf("syscall.Setsid() error : %w", err)
+		log.Println(err)
+		return err
 	}
 
-	// NOTE! All error after disconection from parent must be writen into simulator log
-	// as there is no other way to report about a problems in daemon mode.
-	// Use handleErr() to do so.
-
-	// create new simulator engine
-	sim := NewSimulator(logFile)
-	// begin simulation of initial synchronisation
-	sim.Simulate("Start")
+	return d.Serve()
+}
 
-	// main daemon loop
-	var exit bool
-	for !exit {
-		// accept connection to socket
-		conn, err := ln.Accept()
-		if err != nil {
-			return handleErr("accepting connection error: %w", err)
+// record records the status and cli.log of yandex-disk utility into the scenario file:
+// <yandex-disk> <scenario file> [--interval <duration>] [--duration <duration>] [--cli-log <path>]
+func record(args ...string) error {
+	var files []string
+	interval, duration, cliLog := recordInterval, time.Duration(0), ""
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "--") {
+			files = append(files, a)
+			continue
 		}
-
-		// handle received connection
-		exit, err = handleConnection(conn, sim, syncDir)
+		name, value, ok := strings.Cut(a, "=")
+		if !ok && i+1 < len(args) {
+			i++
+			value, ok = args[i], true
+		}
+		var err error
+		switch {
+		case ok && name == "--interval":
+			if interval, err = time.ParseDuration(value); err != nil || interval <= 0 {
+				return productErr(exitUsage, fmt.Sprintf("Error: incorrect interval value '%s'", value))
+			}
+		case ok && name == "--duration":
+			if duration, err = time.ParseDuration(value); err != nil || duration < 0 {
+				return productErr(exitUsage, fmt.Sprintf("Error: incorrect duration value '%s'", value))
+			}
+		case ok && name == "--cli-log":
+			cliLog = value
+		default:
+			return productErr(exitUsage, fmt.Sprintf("Error: unknown option: '%s'", a))
+		}
+	}
+	if len(files) != 2 {
+		return productErr(exitUsage, "Error: yandex-disk utility and scenario file have to be specified")
+	}
+	if cliLog == "" {
+		// yandex-disk utility uses the same configuration as simulator
+		dir, _, err := checkCfg()
 		if err != nil {
-			return handleErr("connection handling error: %w", err)
+			return err
 		}
+		cliLog = simulator.CliLogPath(dir)
+	}
+	// recording continues until the duration expires or the recording is interrupted
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
 	}
+	fmt.Println("Recording... Press Ctrl+C to finish.")
+	rec, err := simulator.Record(ctx, files[0], cliLog, interval)
+	if err != nil {
+		return fmt.Errorf("Error: %w", err)
+	}
+	if err = rec.Save(files[1]); err != nil {
+		return fmt.Errorf("Error: %w", err)
+	}
+	fmt.Printf("%d events recorded into %s\n", len(rec.Events), files[1])
 	return nil
 }
 
-// handleErr formats error, writes it into simulator log and returns formatted error
-func handleErr(format string, params ...interface{}) error {
-	err := fmt.Errorf(format, params...)
-	log.Println(err)
-	return err
-}
-
-// handleConnection reads the command from connection, perform required operation,
-// and sends back the response on command through the same connection.
-// It returns error and stop flag that instruct the main daemon loop to continue or to stop.
-func handleConnection(conn net.Conn, sim *Simulator, syncDir string) (bool, error) {
-	defer conn.Close()
-
-	// read command
-	buf := make([]byte, 8)
-	nr, err := conn.Read(buf)
-	if err != nil {
-		return true, fmt.Errorf("connection reading error: %w", err)
-	}
-	cmd := string(buf[0:nr])
-	log.Println("Received:", cmd)
-	// check the synchronization path existence and return error in case of absence of it
-	if notExists(syncDir) && cmd != "stop" {
-		if _, err = conn.Write([]byte("Error: Indicated directory does not exist")); err != nil {
-			return true, fmt.Errorf("writing to connecton error: %w", err)
+// absScenario returns the markov command arguments with absolute path of scenario file
+func absScenario(args []string) []string {
+	res := make([]string, len(args))
+	for i, a := range args {
+		res[i] = a
+		if strings.HasPrefix(a, "-") || i > 0 && (args[i-1] == "--seed" || args[i-1] == "--steps") {
+			continue
+		}
+		if p, err := filepath.Abs(a); err == nil {
+			res[i] = p
 		}
-		return false, nil // continue accepting of incoming connections
-	}
-	// handle command and send back the command execution results
-	switch cmd {
-	case "status": // reply into socket by current message
-		_, err = conn.Write([]byte(sim.GetMessage()))
-	case "sync": // begin the synchronization simulation
-		sim.Simulate("Synchronization")
-		// we have to send back something to show that daemon still active
-		_, err = conn.Write([]byte{0})
-	case "error": // switch to error state
-		sim.Simulate("Error")
-		_, err = conn.Write([]byte{0})
-	case "stop": // stop the daemon
-		// send back nothing to show that daemon is not active any more
-		// simulate normal exit
-		sim.Simulate("Stop")
-		time.Sleep(stopTime)
-		return true, nil // stop accepting of incoming connections
-	default:
-		// unexpected command
-		return true, fmt.Errorf("command handling error: unexpected command '%s' received", cmd)
-	}
-	// handle all connection writing errors in switch here
-	if err != nil {
-		return true, fmt.Errorf("writing to connection error: %w", err)
 	}
-	return false, nil // continue accepting of incoming connections
+	return res
 }
 
-// send command to daemon and handle the response from it
-func handleCommand(cmd string) error {
+// send command to daemon and handle the response from it (the daemon replies are
+// translated here by the message catalog of client)
+func handleCommand(cat *simulator.Catalog, cmd string, args ...string) error {
 	if notExists(socketPath) {
-		return fmt.Errorf("%s", "Error: daemon not started")
-	}
-	// open socket as client
-	conn, err := net.DialTimeout("unix", socketPath, time.Duration(time.Second))
-	if err != nil {
-		return fmt.Errorf("socket dial error: %w", err)
-	}
-	defer conn.Close()
-	// send cmd to socket
-	_, err = conn.Write([]byte(cmd))
-	if err != nil {
-		return fmt.Errorf("socket write error: %w", err)
+		return productErr(exitNotStarted, "Error: daemon not started")
 	}
-	// read response
-	buf := make([]byte, 512)
-	n, err := conn.Read(buf)
-	if err != nil {
-		if err == io.EOF { // closed socket mean that daemon was stopped
-			fmt.Println("Daemon stopped.")
-			return nil
+	// output the stream of updates until the daemon stops
+	if cmd == "watch" {
+		conn, err := simulator.Dial(socketPath, cmd, args...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err = io.Copy(os.Stdout, conn); err != nil {
+			return fmt.Errorf("socket read error: %w ", err)
 		}
-		return fmt.Errorf("socket read error: %w ", err)
+		return nil
 	}
-	m := string(buf[0:n])
-	if n > 1 {
-		// Handle errors from daemon
-		if strings.HasPrefix(m, ("Error:")) {
-			return fmt.Errorf(m)
+	m, err := simulator.Command(socketPath, cmd, args...)
+	switch {
+	case errors.Is(err, simulator.ErrStopped):
+		fmt.Println(cat.Message("Daemon stopped."))
+	case err != nil:
+		return err
+	case m != "":
+		// output non-error messages from daemon, the status messages are translated
+		if slices.Contains([]string{"status", "step", "wait"}, cmd) {
+			m = cat.Text(m)
 		}
-		// output non-error messages from daemon
 		fmt.Println(m)
 	}
 	return nil
 }
 
 // checkCfg checks the daemon configuration and requered files/directories.
-// It returns error or the synchronized path read from configuration file.
-func checkCfg() (string, error) {
+// It returns error or the synchronized path and the token file path read from
+// configuration file.
+func checkCfg() (string, string, error) {
+	dir, auth, err := readCfg()
+	if err != nil {
+		return "", "", err
+	}
+	// return error if value of DIR is empty or specified path is not exists
+	if notExists(dir) {
+		return "", "", productErr(exitConfig, "Error: option 'dir' is missing") // Original product error.
+	}
+	// return error if value of AUTH is empty or specified path is not exists
+	if notExists(auth) {
+		return "", "", productErr(exitToken, "Error: file with OAuth token hasn't been found.\nUse 'token' command to authenticate and create this file") // Original product error.
+	}
+	return dir, auth, nil
+}
+
+// readCfg returns the synchronized path and the token file path read from configuration file
+func readCfg() (string, string, error) {
 	// make the configuration file path
-	confFile := path.Join(os.ExpandEnv(cmp.Or(os.Getenv("Sim_ConfDir"), configPath)), configFileName)
+	confFile := path.Join(os.ExpandEnv(cmp.Or(os.Getenv("Sim_ConfDir"), configPath)), simulator.ConfigFileName)
 	log.Println("Config file: ", confFile)
 	// read data from configuration file
 	f, err := os.Open(confFile)
 	if err != nil {
-		return "", fmt.Errorf("%s", "Error: option 'dir' is missing")
+		return "", "", productErr(exitConfig, "Error: option 'dir' is missing")
 	}
 	defer f.Close()
 	reader := bufio.NewReader(f)
@@ -348,17 +695,37 @@ func checkCfg() (string, error) {
 		}
 	}
 	if err != nil && err != io.EOF {
-		return "", fmt.Errorf("reading of '%s' error: %w", confFile, err)
+		return "", "", fmt.Errorf("reading of '%s' error: %w", confFile, err)
 	}
-	// return error if value of DIR is empty or specified path is not exists
-	if notExists(dir) {
-		return "", fmt.Errorf("%s", "Error: option 'dir' is missing") // Original product error.
+	return dir, auth, nil
+}
+
+// token writes the OAuth token (Sim_Token or "token" by default) into the token file
+// and makes the running daemon check it: token [<token>]
+func token(args ...string) error {
+	if len(args) > 1 {
+		return productErr(exitUsage, fmt.Sprintf("%s '%s'", "Error: unknown option:", args[1]))
 	}
-	// return error if value of AUTH is empty or specified path is not exists
-	if notExists(auth) {
-		return "", fmt.Errorf("%s", "Error: file with OAuth token hasn't been found.\nUse 'token' command to authenticate and create this file") // Original product error.
+	_, auth, err := readCfg()
+	if err != nil {
+		return err
+	}
+	if auth == "" {
+		return productErr(exitConfig, "Error: option 'auth' is missing")
+	}
+	value := cmp.Or(os.Getenv("Sim_Token"), "token")
+	if len(args) == 1 {
+		value = args[0]
+	}
+	if err = os.WriteFile(auth, []byte(value), 0600); err != nil {
+		return fmt.Errorf("token file '%s' writing error: %w", auth, err)
+	}
+	// the stopped daemon checks the token on start
+	if notExists(socketPath) {
+		return nil
 	}
-	return dir, nil
+	_, err = simulator.Command(socketPath, "token")
+	return err
 }
 
 // setup creates the configuration file, file with token and folder for synchronisation
@@ -367,25 +734,5 @@ func setup() error {
 	cfgPath := cmp.Or(os.Getenv("Sim_ConfDir"), os.ExpandEnv(configPath))
 	// determine the syncronisation path
 	syncPath := cmp.Or(os.Getenv("Sim_SyncDir"), os.ExpandEnv(syncPath))
-	if err := os.MkdirAll(cfgPath, 0750); err != nil {
-		return fmt.Errorf("config path creation error: %w", err)
-	}
-	// create the token file
-	auth := path.Join(cfgPath, "passwd")
-	if notExists(auth) {
-		if err := os.WriteFile(auth, []byte("token"), 0600); err != nil {
-			return fmt.Errorf("yandex-disk token file '%s' writing error: %w", auth, err)
-		}
-	}
-	// create the configuration file and write the configuration values in it
-	cfg := path.Join(cfgPath, configFileName)
-	err := os.WriteFile(cfg, []byte("proxy=\"no\"\n\nauth=\""+auth+"\"\ndir=\""+syncPath+"\"\n\n"), 0600)
-	if err != nil {
-		return fmt.Errorf("config file '%s' writing error: %w", cfg, err)
-	}
-	// create the folder for synchronisation
-	if err = os.MkdirAll(syncPath, 0750); err != nil {
-		return fmt.Errorf("synchronization Dir '%s' creation error: %w", syncPath, err)
-	}
-	return nil
+	return simulator.Setup(cfgPath, syncPath)
 }
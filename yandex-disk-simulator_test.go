@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/slytomcat/yandex-disk-simulator/simulator"
 	"github.com/stretchr/testify/require"
 )
 
@@ -35,10 +40,10 @@ func getOutput() func() string {
 	}
 }
 
-// execute command and capture stdout
-func execCommand(t *testing.T, command string) string {
+// execute command with arguments and capture stdout
+func execCommand(t *testing.T, command ...string) string {
 	out := getOutput()
-	err := doMain(exe, command)
+	err := doMain(append([]string{exe}, command...)...)
 	res := out()
 	require.NoError(t, err)
 	return res
@@ -49,7 +54,7 @@ func getStatusAfterEvent(t *testing.T, timeout time.Duration) string {
 	watch, err := fsnotify.NewWatcher()
 	require.NoError(t, err)
 	defer watch.Close()
-	require.NoError(t, watch.Add(filepath.Join(SyncDirPath, logDirName, logFileName)))
+	require.NoError(t, watch.Add(simulator.CliLogPath(SyncDirPath)))
 	select {
 	case err := <-watch.Errors:
 		t.Fatal(err.Error())
@@ -63,12 +68,23 @@ func getStatusAfterEvent(t *testing.T, timeout time.Duration) string {
 }
 
 func TestMain(m *testing.M) {
+	// run the utility main function in the test process started by execMain
+	if os.Getenv("Sim_TestMain") != "" {
+		version = "v.expected"
+		os.Args = append([]string{exe}, strings.Fields(os.Getenv("Sim_TestArgs"))...)
+		main()
+		os.Exit(0)
+	}
 	// set environment variables for setup of simulator
 	SyncDirPath = os.ExpandEnv(SyncDirPath)
 	os.Setenv("Sim_SyncDir", SyncDirPath)
 	ConfigFilePath = os.ExpandEnv(ConfigFilePath)
 	os.Setenv("Sim_ConfDir", ConfigFilePath)
 	version = "v.expected"
+	// tests expect the English output
+	os.Setenv("LANG", "C")
+	os.Unsetenv("LC_ALL")
+	os.Unsetenv("LC_MESSAGES")
 
 	// Run tests
 	errn := m.Run()
@@ -108,14 +124,32 @@ func TestDoMain01Version(t *testing.T) {
 // try to start with wrong and long command
 func TestDoMain02WrongCommand(t *testing.T) {
 	err := doMain(exe, "wrongCMD_cut_it")
-	require.Equal(t, errors.New("Error: unknown command: 'wrongCMD'"), err)
+	require.Equal(t, productErr(exitUsage, "Error: unknown command: 'wrongCMD'"), err)
+}
+
+// try to start with unknown option
+func TestDoMain03StartWrongOption(t *testing.T) {
+	err := doMain(exe, "start", "--read-write")
+	require.EqualError(t, err, "Error: unknown option: '--read-write'")
+}
+
+// try to run command with incorrect time scale factor
+func TestDoMain03WrongTimeScale(t *testing.T) {
+	t.Setenv("Sim_TimeScale", "fast")
+	require.EqualError(t, doMain(exe, "status"), "incorrect time scale factor 'fast': positive number expected")
+}
+
+// try to run command with incorrect step mode value
+func TestDoMain03WrongStepMode(t *testing.T) {
+	t.Setenv("Sim_StepMode", "maybe")
+	require.EqualError(t, doMain(exe, "status"), "incorrect step mode value 'maybe': boolean value expected")
 }
 
 // try to start without configuration
 func TestDoMain04StartNoConfig(t *testing.T) {
 	err := doMain(exe, "start")
 	require.Error(t, err, "no error for start without config")
-	require.Equal(t, errors.New("Error: option 'dir' is missing"), err)
+	require.Equal(t, productErr(exitConfig, "Error: option 'dir' is missing"), err)
 }
 
 // try to setup the configuration
@@ -127,7 +161,7 @@ func TestDoMain05Setup(t *testing.T) {
 func TestDoMain07Command2NotStarted(t *testing.T) {
 	err := doMain(exe, "status")
 	require.Error(t, err, "no error for command to not started")
-	require.Equal(t, errors.New("Error: daemon not started"), err)
+	require.Equal(t, productErr(exitNotStarted, "Error: daemon not started"), err)
 }
 
 // try to start daemon with wrong executable name
@@ -441,6 +475,29 @@ Last synchronized items:
 			getStatusAfterEvent(t, 2*time.Second))
 	})
 
+	t.Run("step without step mode", func(t *testing.T) {
+		require.EqualError(t, doMain(exe, "step"), "Error: daemon is not in step mode")
+	})
+
+	t.Run("wait for idle after error", func(t *testing.T) {
+		require.Empty(t, execCommand(t, "error"))
+		start := time.Now()
+		require.Contains(t, execCommand(t, "wait", "idle"), "Synchronization core status: idle\n")
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("status translated by client", func(t *testing.T) {
+		// the daemon is started with English locale
+		t.Setenv("LANG", "ru_RU.UTF-8")
+		require.Contains(t, execCommand(t, "status"), "Статус ядра синхронизации: idle\n")
+		require.EqualError(t, doMain(exe, "wait", "busy", "--timeout", "10ms"), "Ошибка: 'busy' state hasn't been reached within 10ms")
+	})
+
+	t.Run("wait timeout", func(t *testing.T) {
+		err := doMain(exe, "wait", "busy", "--timeout", "10ms")
+		require.EqualError(t, err, "Error: 'busy' state hasn't been reached within 10ms")
+	})
+
 	t.Run("status with removed sync path", func(t *testing.T) {
 		os.RemoveAll(SyncDirPath)
 		out := getOutput()
@@ -468,3 +525,263 @@ Last synchronized items:
 		require.Empty(t, res)
 	})
 }
+
+// check the synchronization mode selection by start options
+func TestParseMode(t *testing.T) {
+	for _, tc := range []struct {
+		opts []string
+		mode simulator.SyncMode
+	}{
+		{nil, simulator.ModeNormal},
+		{[]string{"--overwrite"}, simulator.ModeNormal},
+		{[]string{"--read-only"}, simulator.ModeReadOnly},
+		{[]string{"--read-only", "--overwrite"}, simulator.ModeOverwrite},
+		{[]string{"--overwrite", "--read-only"}, simulator.ModeOverwrite},
+	} {
+		mode, err := parseMode(tc.opts)
+		require.NoError(t, err)
+		require.Equal(t, tc.mode, mode, tc.opts)
+	}
+}
+
+// try to make the markov scenario path absolute
+func TestAbsScenario(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.Equal(t,
+		[]string{"--seed", "5", "--steps=3", filepath.Join(wd, "soak.json")},
+		absScenario([]string{"--seed", "5", "--steps=3", "soak.json"}))
+	require.Equal(t, []string{"/tmp/soak.json", "--steps", "2"}, absScenario([]string{"/tmp/soak.json", "--steps", "2"}))
+}
+
+// try to record the output of fake yandex-disk utility
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "yandex-disk")
+	require.NoError(t, os.WriteFile(fake, []byte("#!/bin/sh\necho \"Synchronization core status: $1\"\n"), 0700))
+	cliLog := filepath.Join(dir, "cli.log")
+	file := filepath.Join(dir, "recording.json")
+	res := execCommand(t, "record", fake, file, "--interval=10ms", "--duration", "100ms", "--cli-log", cliLog)
+	require.Equal(t, "Recording... Press Ctrl+C to finish.\n1 events recorded into "+file+"\n", res)
+	rec, err := simulator.LoadRecording(file)
+	require.NoError(t, err)
+	require.Equal(t, "Synchronization core status: status", rec.Events[0].Message)
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{fake}, "Error: yandex-disk utility and scenario file have to be specified"},
+		{[]string{fake, file, "--interval", "0s"}, "Error: incorrect interval value '0s'"},
+		{[]string{fake, file, "--duration=soon"}, "Error: incorrect duration value 'soon'"},
+		{[]string{fake, file, "--fast"}, "Error: unknown option: '--fast'"},
+	} {
+		require.EqualError(t, doMain(append([]string{exe, "record"}, tc.args...)...), tc.err)
+	}
+}
+
+// try to use output profiles
+func TestProfileOption(t *testing.T) {
+	require.Equal(t, exe+" 0.1.5.1039\n", execCommand(t, "--profile", "0.1.5", "version"))
+	t.Setenv("Sim_Profile", "0.1.6")
+	require.Equal(t, exe+" 0.1.6.1080\n", execCommand(t, "-v"))
+	require.Equal(t, exe+" 0.1.5.1039\n", execCommand(t, "-v", "--profile=0.1.5"))
+	require.Contains(t, execCommand(t, "help"), "\tversion: "+version+" (yandex-disk 0.1.6.1080 profile)\n")
+	require.EqualError(t, doMain(exe, "--profile", "0.1.5", "status"), "Error: daemon is not running")
+	require.EqualError(t, doMain(exe, "status"), "Error: daemon not started")
+	require.EqualError(t, doMain(exe, "--profile", "2.0", "status"), "unknown profile '2.0': one of 0.1.5, 0.1.6 expected")
+	t.Setenv("Sim_Profile", "0.1")
+	require.EqualError(t, doMain(exe, "status"), "unknown profile '0.1': one of 0.1.5, 0.1.6 expected")
+}
+
+// try to separate the profile option from other arguments
+func TestProfileOptionArgs(t *testing.T) {
+	args, name := profileOption([]string{exe, "--profile", "0.1.5", "start", "--read-only"})
+	require.Equal(t, []string{exe, "start", "--read-only"}, args)
+	require.Equal(t, "0.1.5", name)
+	args, name = profileOption([]string{exe, "status", "--profile=0.1.6"})
+	require.Equal(t, []string{exe, "status"}, args)
+	require.Equal(t, "0.1.6", name)
+}
+
+// try to get the localized output
+func TestLocalizedOutput(t *testing.T) {
+	t.Setenv("LANG", "ru_RU.UTF-8")
+	require.EqualError(t, doMain(exe, "status"), "Ошибка: демон не запущен")
+	require.EqualError(t, doMain(exe, "wrongCommand"), "Ошибка: неизвестная команда: 'wrongCom'")
+	// the translated error keeps the original one
+	err := doMain(exe, "status")
+	require.EqualError(t, errors.Unwrap(err), "Error: daemon not started")
+	require.Equal(t, exitNotStarted, exitCode(err))
+	t.Setenv("LC_MESSAGES", "uk_UA.UTF-8")
+	require.EqualError(t, doMain(exe, "status"), "Помилка: демон не запущено")
+	t.Setenv("LC_ALL", "en_US.UTF-8")
+	require.EqualError(t, doMain(exe, "status"), "Error: daemon not started")
+	t.Setenv("LC_ALL", "ru_RU.UTF-8")
+	require.EqualError(t, doMain(exe, "--profile", "0.1.5", "status"), "Ошибка: демон не запущен")
+}
+
+// execute the utility main function in separate process and return its stdout, stderr and exit code
+func execMain(t *testing.T, env []string, args ...string) (string, string, int) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), append(env, "Sim_TestMain=1", "Sim_TestArgs="+strings.Join(args, " "))...)
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// try to get the original streams and exit codes of the utility
+func TestMainExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	noToken := filepath.Join(dir, "no-token")
+	require.NoError(t, simulator.Setup(noToken, filepath.Join(dir, "Yandex.Disk")))
+	require.NoError(t, os.Remove(filepath.Join(noToken, "passwd")))
+	for _, tc := range []struct {
+		name   string
+		env    []string
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{"help", nil, []string{"help"}, fmt.Sprintf(helpMsg, exe, version), "", 0},
+		{"no command", nil, nil, "",
+			"Error: command hasn't been specified. Use the --help command to access help\nor setup to launch the setup wizard.\n", exitUsage},
+		{"unknown command", nil, []string{"wrongCMD"}, "", "Error: unknown command: 'wrongCMD'\n", exitUsage},
+		{"unknown option", nil, []string{"start", "--read-write"}, "", "Error: unknown option: '--read-write'\n", exitUsage},
+		{"daemon not started", []string{"Sim_Socket=" + filepath.Join(dir, "socket")}, []string{"status"}, "", "Error: daemon not started\n", exitNotStarted},
+		{"console without daemon", []string{"Sim_Socket=" + filepath.Join(dir, "socket")}, []string{"console"}, "", "Error: daemon not started\n", exitNotStarted},
+		{"config missing", []string{"Sim_ConfDir=" + filepath.Join(dir, "none")}, []string{"start"}, "", "Error: option 'dir' is missing\n", exitConfig},
+		{"token missing", []string{"Sim_ConfDir=" + noToken}, []string{"start"}, "",
+			"Error: file with OAuth token hasn't been found.\nUse 'token' command to authenticate and create this file\n", exitToken},
+		{"other error", []string{"Sim_TimeScale=fast"}, []string{"status"}, "", "incorrect time scale factor 'fast': positive number expected\n", exitFailure},
+		{"translated error", []string{"LANG=ru_RU.UTF-8"}, []string{"wrongCMD"}, "", "Ошибка: неизвестная команда: 'wrongCMD'\n", exitUsage},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout, stderr, code := execMain(t, tc.env, tc.args...)
+			require.Equal(t, tc.stdout, stdout)
+			require.Equal(t, tc.stderr, stderr)
+			require.Equal(t, tc.code, code)
+		})
+	}
+}
+
+// try to fail the daemon start after the fork
+func TestStartFailure(t *testing.T) {
+	require.NoError(t, doMain(exe, "setup"))
+	// the daemon process is the test binary that runs the daemon command
+	t.Setenv("Sim_TestMain", "1")
+	t.Setenv("Sim_TestArgs", "daemon "+SyncDirPath)
+	for name, fail := range startFailures {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("Sim_StartFail", name)
+			out := getOutput()
+			err := doMain(os.Args[0], "start")
+			require.Equal(t, "Starting daemon process...Fail\n", out())
+			require.EqualError(t, err, fail.Error())
+			require.Equal(t, exitCode(fail), exitCode(err))
+			require.True(t, notExists(socketPath))
+		})
+	}
+	t.Setenv("Sim_StartFail", "later")
+	err := doMain(os.Args[0], "start")
+	require.EqualError(t, err, "incorrect start failure 'later': dir, token, instance or network expected")
+}
+
+// try to write the token and to start the daemon with rejected token
+func TestToken(t *testing.T) {
+	confDir := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, simulator.Setup(confDir, SyncDirPath))
+	t.Setenv("Sim_ConfDir", confDir)
+	require.NoError(t, doMain(exe, "token", "valid"))
+	data, err := os.ReadFile(filepath.Join(confDir, "passwd"))
+	require.NoError(t, err)
+	require.Equal(t, "valid", string(data))
+	require.EqualError(t, doMain(exe, "token", "valid", "more"), "Error: unknown option: 'more'")
+	// the daemon process is the test binary that runs the daemon command
+	t.Setenv("Sim_TestMain", "1")
+	t.Setenv("Sim_TestArgs", "daemon "+SyncDirPath)
+	t.Setenv("Sim_Token", "other")
+	out := getOutput()
+	err = doMain(os.Args[0], "start")
+	require.Equal(t, "Starting daemon process...Fail\n", out())
+	require.EqualError(t, err, errTokenRejected.Error())
+	require.Equal(t, exitToken, exitCode(err))
+	t.Setenv("Sim_Token", "valid")
+	t.Setenv("Sim_TokenExpiry", "never")
+	out = getOutput()
+	err = doMain(os.Args[0], "start")
+	out()
+	require.EqualError(t, err, "incorrect token expiry 'never': positive duration expected")
+	require.Equal(t, exitFailure, exitCode(err))
+}
+
+// try to crash the daemon process with exit code and by signal
+func TestDaemonCrashExit(t *testing.T) {
+	dir := t.TempDir()
+	syncDir := filepath.Join(dir, "Yandex.Disk")
+	require.NoError(t, simulator.Setup(filepath.Join(dir, "config"), syncDir))
+	for _, tc := range []struct {
+		args   []string
+		code   int
+		signal syscall.Signal
+	}{
+		{nil, 1, 0},
+		{[]string{"--keep-socket", "--signal", "KILL"}, -1, syscall.SIGKILL},
+		{[]string{"--keep-socket", "--signal", "TERM"}, -1, syscall.SIGTERM},
+	} {
+		socket := filepath.Join(dir, "socket")
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "Sim_TestMain=1", "Sim_TestArgs=daemon "+syncDir, "Sim_Socket="+socket, "Sim_TimeScale=0.01")
+		require.NoError(t, cmd.Start())
+		// the daemon is ready when it replies on status
+		require.Eventually(t, func() bool {
+			_, err := simulator.Command(socket, "status")
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		_, err := simulator.Command(socket, "crash", tc.args...)
+		require.ErrorIs(t, err, simulator.ErrStopped)
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, cmd.Wait(), &exitErr)
+		require.Equal(t, tc.code, cmd.ProcessState.ExitCode())
+		if tc.signal != 0 {
+			require.Equal(t, tc.signal, cmd.ProcessState.Sys().(syscall.WaitStatus).Signal())
+		}
+		require.Equal(t, tc.signal != 0, !notExists(socket))
+		os.Remove(socket)
+	}
+}
+
+// check the console view updates, rendering and key bindings
+func TestConsoleView(t *testing.T) {
+	v := &consoleView{}
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range 7 {
+		v.update(simulator.Update{Time: start.Add(time.Duration(i) * time.Second), Type: "status", State: "busy", Message: "Synchronization core status: busy\n"})
+	}
+	for i := range 12 {
+		v.update(simulator.Update{Type: "log", Message: fmt.Sprintf("line %d", i)})
+	}
+	require.Equal(t, []string{"03:04:07.000 busy", "03:04:08.000 busy", "03:04:09.000 busy", "03:04:10.000 busy", "03:04:11.000 busy"}, v.transitions)
+	require.Len(t, v.logLines, consoleLogLines)
+	require.Equal(t, "line 11", v.logLines[consoleLogLines-1])
+	v.reply = "sync: done"
+	screen := v.render()
+	require.True(t, strings.HasPrefix(screen, "\x1b[H\x1b[2JKeys: s - sync, "), screen)
+	require.Contains(t, screen, "\nStatus:\nSynchronization core status: busy\n\nTransitions:\n03:04:07.000 busy\n")
+	require.Contains(t, screen, "\ncli.log:\nline 2\n")
+	require.True(t, strings.HasSuffix(screen, "line 11\n\nsync: done\n"))
+
+	require.Equal(t, []string{"sync"}, v.consoleCommand('s'))
+	require.Equal(t, []string{"network"}, v.consoleCommand('n'))
+	require.Nil(t, v.consoleCommand('z'))
+	for i := 1; i <= 10; i++ {
+		require.Equal(t, []string{"progress", strconv.Itoa(i * 10)}, v.consoleCommand('p'))
+	}
+	require.Equal(t, []string{"progress", "0"}, v.consoleCommand('p'))
+}